@@ -0,0 +1,100 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"github.com/hashicorp/go-version"
+	"regexp"
+	"strings"
+)
+
+// ArchiveInfo is the version, operating system and
+// architecture within the file name of a release
+// archive.
+type ArchiveInfo struct {
+	Version *version.Version
+	// The operating system such as "linux", empty if the
+	// file name does not contain one.
+	OS string
+	// The architecture such as "amd64", empty if the file
+	// name does not contain one.
+	Arch string
+}
+
+// archiveVersionRegex matches the version within the file
+// name of an archive, without the pre-release.
+var archiveVersionRegex = regexp.MustCompile(`v?\d+\.\d+\.\d+`)
+
+// archiveExtensions are the extensions removed from the
+// file name of an archive before it is parsed.
+var archiveExtensions = []string{".tar.gz", ".tar.bz2", ".tar.xz", ".tgz", ".zip", ".tar", ".gz", ".exe"}
+
+// archiveOS and archiveArch are the operating systems and
+// architectures known to Go, which end the pre-release
+// of a version within the file name of an archive.
+var (
+	archiveOS = map[string]bool{
+		"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true,
+		"illumos": true, "ios": true, "js": true, "linux": true, "netbsd": true,
+		"openbsd": true, "plan9": true, "solaris": true, "wasip1": true, "windows": true,
+	}
+	archiveArch = map[string]bool{
+		"386": true, "amd64": true, "arm": true, "arm64": true, "loong64": true,
+		"mips": true, "mips64": true, "mips64le": true, "mipsle": true, "ppc64": true,
+		"ppc64le": true, "riscv64": true, "s390x": true, "wasm": true,
+	}
+)
+
+// ParseArchiveName parses the file name of a release
+// archive such as "my-repo_v0.0.2_linux_amd64.zip" or
+// "my-repo-v0.0.2-rc.1-linux-amd64.tar.gz". Parts
+// following the version are separated by either
+// underscores or dashes, a pre-release must
+// directly follow the version with a dash.
+// False is returned if the name does not
+// contain a version.
+func ParseArchiveName(name string) (ArchiveInfo, bool) {
+	loc := archiveVersionRegex.FindStringIndex(name)
+	if loc == nil {
+		return ArchiveInfo{}, false
+	}
+
+	var (
+		info ArchiveInfo
+		ver  = name[loc[0]:loc[1]]
+		rest = name[loc[1]:]
+	)
+
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(strings.ToLower(rest), ext) {
+			rest = rest[:len(rest)-len(ext)]
+			break
+		}
+	}
+
+	var pre []string
+	for i, part := range strings.FieldsFunc(rest, func(r rune) bool { return r == '_' || r == '-' }) {
+		switch {
+		case archiveOS[part] && info.OS == "":
+			info.OS = part
+		case archiveArch[part] && info.Arch == "":
+			info.Arch = part
+		case info.OS == "" && info.Arch == "" && len(pre) == i && strings.HasPrefix(rest, "-"):
+			pre = append(pre, part)
+		}
+	}
+
+	if len(pre) > 0 {
+		ver += "-" + strings.Join(pre, "-")
+	}
+
+	v, err := version.NewVersion(ver)
+	if err != nil {
+		return ArchiveInfo{}, false
+	}
+	info.Version = v
+
+	return info, true
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseArchiveName(t *testing.T) {
+	tt := map[string]struct {
+		input string
+		want  interface{}
+		os    string
+		arch  string
+	}{
+		"Underscores": {
+			"verbis_v0.0.2_linux_amd64.zip",
+			"v0.0.2",
+			"linux",
+			"amd64",
+		},
+		"Dashes": {
+			"app-v1.2.3-linux-amd64.tar.gz",
+			"v1.2.3",
+			"linux",
+			"amd64",
+		},
+		"Pre-Release Underscores": {
+			"verbis_v0.0.2-rc.1_darwin_arm64.zip",
+			"v0.0.2-rc.1",
+			"darwin",
+			"arm64",
+		},
+		"Pre-Release Dashes": {
+			"app-v1.2.3-beta-2-windows-386.zip",
+			"v1.2.3-beta-2",
+			"windows",
+			"386",
+		},
+		"No Platform": {
+			"verbis_v0.0.2.zip",
+			"v0.0.2",
+			"",
+			"",
+		},
+		"Pre-Release No Platform": {
+			"app-v1.2.3-rc.1.tar.gz",
+			"v1.2.3-rc.1",
+			"",
+			"",
+		},
+		"No Prefix": {
+			"verbis_1.0.0_linux_arm.tgz",
+			"1.0.0",
+			"linux",
+			"arm",
+		},
+		"No Version": {
+			"verbis_linux_amd64.zip",
+			nil,
+			"",
+			"",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			got, ok := ParseArchiveName(test.input)
+			if !ok {
+				assert.Nil(t, test.want)
+				return
+			}
+			assert.Equal(t, test.want, got.Version.Original())
+			assert.Equal(t, test.os, got.OS)
+			assert.Equal(t, test.arch, got.Arch)
+		})
+	}
+}
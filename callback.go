@@ -0,0 +1,82 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"database/sql"
+)
+
+// MigrateFn is the function type of the Up and Down
+// functions of a migration, which are run within
+// the transaction of the migration.
+type MigrateFn func(mc *MigrationContext) error
+
+// MigrationContext is passed to the Up and Down functions
+// of a migration.
+type MigrationContext struct {
+	// The context passed to the Updater, or background
+	// if none was given.
+	Context context.Context
+	// The transaction the migration is running in, nil if
+	// there is no database or the migration uses TxNone.
+	Tx *sql.Tx
+	// The database, nil if there is none set.
+	DB *sql.DB
+	// The version being migrated from, such as the currently
+	// running version when updating.
+	From string
+	// The version being migrated to.
+	To string
+	// The migration that is running.
+	Migration *Migration
+	// The logger set in the options.
+	Logger Logger
+}
+
+// Logger is used for logging from within migrations, it
+// is satisfied by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// nopLogger is the Logger used when none is set in the
+// options.
+type nopLogger struct{}
+
+func (nopLogger) Printf(string, ...interface{}) {}
+
+// logger returns the Logger set in the options, or one
+// that discards everything.
+func (u *Updater) logger() Logger {
+	if u.opts.Logger == nil {
+		return nopLogger{}
+	}
+	return u.opts.Logger
+}
+
+// migrationContext returns the MigrationContext for the
+// migration running within the batch using the execer
+// passed.
+func (u *Updater) migrationContext(b *batch, m *Migration, ex execer) *MigrationContext {
+	mc := &MigrationContext{
+		Context:   b.ctx,
+		Migration: m,
+		Logger:    u.logger(),
+	}
+	if b.from != nil {
+		mc.From = b.from.Original()
+	}
+	if b.to != nil {
+		mc.To = b.to.Original()
+	}
+	if u.opts.hasDB {
+		mc.DB = u.opts.DB
+	}
+	if tx, ok := ex.(*sql.Tx); ok {
+		mc.Tx = tx
+	}
+	return mc
+}
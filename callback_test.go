@@ -0,0 +1,189 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestUpdater_RunFunctions(t *testing.T) {
+	tt := map[string]struct {
+		up   MigrateFn
+		mode TxMode
+		mock func(m sqlmock.Sqlmock)
+		want interface{}
+		code Status
+		log  string
+	}{
+		"Shared": {
+			func(mc *MigrationContext) error {
+				if mc.Tx == nil {
+					return fmt.Errorf("no transaction")
+				}
+				_, err := mc.Tx.ExecContext(mc.Context, "UPDATE users SET name = 'test'")
+				mc.Logger.Printf("migrating from %s to %s", mc.From, mc.To)
+				return err
+			},
+			TxShared,
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.1")
+				m.ExpectBegin()
+				m.ExpectExec(v002).WillReturnResult(sqlmock.NewResult(1, 1))
+				m.ExpectExec("UPDATE users").WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.2", true)
+				m.ExpectCommit()
+			},
+			nil,
+			Updated,
+			"migrating from v0.0.1 to v0.0.2\n",
+		},
+		"No Transaction": {
+			func(mc *MigrationContext) error {
+				if mc.Tx != nil || mc.DB == nil {
+					return fmt.Errorf("unexpected transaction")
+				}
+				return nil
+			},
+			TxNone,
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.1")
+				m.ExpectExec(v002).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.2", true)
+			},
+			nil,
+			Updated,
+			"",
+		},
+		"Error": {
+			func(mc *MigrationContext) error {
+				return fmt.Errorf("up error")
+			},
+			TxShared,
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.1")
+				m.ExpectBegin()
+				m.ExpectExec(v002).WillReturnResult(sqlmock.NewResult(1, 1))
+				m.ExpectRollback()
+				expectRecord(m, "v0.0.2", false)
+			},
+			"up error",
+			CallBackError,
+			"",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			test.mock(mock)
+
+			registry := testRegistry(MigrationRegistry{
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), Stage: Patch, Up: test.up, Transaction: test.mode},
+			})
+
+			buf := &bytes.Buffer{}
+			u := Updater{
+				opts:    Options{DB: db, hasDB: true, Logger: log.New(buf, "", 0), Registry: registry},
+				version: version.Must(version.NewVersion("v0.0.1")),
+			}
+
+			code, err := u.runMigrations(context.Background(), u.version, version.Must(version.NewVersion("v0.0.2")))
+			assert.Equal(t, test.code, code)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+			} else {
+				assert.Nil(t, test.want)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+			assert.Equal(t, test.log, buf.String())
+		})
+	}
+}
+
+func TestUpdater_MigrateDownFunctions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	var got *MigrationContext
+	down := func(mc *MigrationContext) error {
+		got = mc
+		return nil
+	}
+
+	expectHistory(mock, "v0.0.1", "v0.0.2")
+	mock.ExpectBegin()
+	expectForget(mock, "v0.0.2")
+	mock.ExpectCommit()
+
+	registry := testRegistry(MigrationRegistry{
+		&Migration{Version: "v0.0.1", Stage: Patch},
+		&Migration{Version: "v0.0.2", Stage: Patch, Up: down, Down: down},
+	})
+
+	u := Updater{
+		opts:    Options{DB: db, hasDB: true, Registry: registry},
+		version: version.Must(version.NewVersion("v0.0.2")),
+	}
+
+	code, err := u.MigrateDown("v0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, Status(Downgraded), code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.NotNil(t, got)
+	assert.NotNil(t, got.Tx)
+	assert.Equal(t, "v0.0.2", got.From)
+	assert.Equal(t, "v0.0.1", got.To)
+	assert.Equal(t, "v0.0.2", got.Migration.Version)
+	assert.Equal(t, nopLogger{}, got.Logger)
+}
+
+func TestMigration_Irreversible(t *testing.T) {
+	fn := func(mc *MigrationContext) error { return nil }
+
+	tt := map[string]struct {
+		input Migration
+		want  bool
+	}{
+		"Empty": {
+			Migration{},
+			false,
+		},
+		"SQL": {
+			Migration{SQL: strings.NewReader(v001)},
+			true,
+		},
+		"SQL Down": {
+			Migration{SQL: strings.NewReader(v001), SQLDown: strings.NewReader(v001Down)},
+			false,
+		},
+		"Up": {
+			Migration{Up: fn},
+			true,
+		},
+		"Up Down": {
+			Migration{Up: fn, Down: fn},
+			false,
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.want, test.input.irreversible())
+		})
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"io"
+	"strings"
+)
+
+const (
+	// MigrateFlag is the flag passed to the newly downloaded
+	// executable when DelegateMigrations is set. The
+	// executable should call HandleMigrate from main
+	// to detect it.
+	MigrateFlag = "-updater-migrate"
+	// FromFlag is the flag used alongside MigrateFlag to
+	// pass the previously running version.
+	FromFlag = "--from"
+	// resultPrefix is the prefix of the line written by
+	// HandleMigrate containing the JSON result.
+	resultPrefix = "updater-result: "
+)
+
+// migrateResult is the machine-readable result written by
+// the executable handling MigrateFlag.
+type migrateResult struct {
+	Status Status `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+var (
+	// ErrNoResult is returned by Update when the delegated
+	// executable did not write a migration result.
+	ErrNoResult = errors.New("no migration result from executable")
+)
+
+// HandleMigrate detects if the executable was started with
+// MigrateFlag by Update and if so, runs the migrations
+// in the registry from the version passed with
+// FromFlag up to the running version. A result
+// is written to w which is read by the
+// previous executable to determine if the
+// update should be kept.
+//
+// True is returned if the flag was detected, in which
+// case the application should exit straight away,
+// with a non zero exit code if an error occurred.
+//
+//	handled, err := u.HandleMigrate(os.Args[1:], os.Stdout)
+//	if handled {
+//		if err != nil {
+//			os.Exit(1)
+//		}
+//		os.Exit(0)
+//	}
+func (u *Updater) HandleMigrate(args []string, w io.Writer) (bool, error) {
+	return u.HandleMigrateContext(context.Background(), args, w)
+}
+
+// HandleMigrateContext is HandleMigrate with a context
+// that bounds running the migrations.
+func (u *Updater) HandleMigrateContext(ctx context.Context, args []string, w io.Writer) (bool, error) {
+	from, ok := parseMigrateArgs(args)
+	if !ok {
+		return false, nil
+	}
+
+	status, err := u.delegated(ctx, from)
+
+	result := migrateResult{Status: status}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	buf, marshalErr := json.Marshal(result)
+	if marshalErr != nil {
+		return true, marshalErr
+	}
+
+	_, writeErr := fmt.Fprintln(w, resultPrefix+string(buf))
+	if writeErr != nil {
+		return true, writeErr
+	}
+
+	return true, err
+}
+
+// delegated runs the migrations from the version passed
+// up to the running version.
+func (u *Updater) delegated(ctx context.Context, from string) (Status, error) {
+	ver, err := version.NewVersion(from)
+	if err != nil {
+		return Unknown, err
+	}
+	return u.runMigrations(ctx, ver, u.version)
+}
+
+// delegate runs the newly installed executable with
+// MigrateFlag and reads the result it outputs.
+func (u *Updater) delegate(ctx context.Context) (Status, error) {
+	// The exit code is ignored in favour of the result,
+	// the error is only returned if there is no result.
+	output, execErr := u.execute(ctx, MigrateFlag, FromFlag, u.opts.Version)
+
+	result, err := parseResult(output)
+	if err != nil {
+		if execErr != nil {
+			return ExecutableError, execErr
+		}
+		return ExecutableError, err
+	}
+
+	if result.Error != "" {
+		return result.Status, errors.New(result.Error)
+	}
+
+	return result.Status, nil
+}
+
+// parseMigrateArgs returns the version passed with
+// FromFlag and true if MigrateFlag is within
+// the arguments.
+func parseMigrateArgs(args []string) (string, bool) {
+	var (
+		found bool
+		from  string
+	)
+
+	for i, arg := range args {
+		switch {
+		case arg == MigrateFlag:
+			found = true
+		case arg == FromFlag && i+1 < len(args):
+			from = args[i+1]
+		case strings.HasPrefix(arg, FromFlag+"="):
+			from = strings.TrimPrefix(arg, FromFlag+"=")
+		}
+	}
+
+	return from, found
+}
+
+// parseResult finds the result line within the output
+// of the executable and unmarshalls it.
+func parseResult(output []byte) (*migrateResult, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+
+	var result *migrateResult
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, resultPrefix) {
+			continue
+		}
+		result = &migrateResult{}
+		err := json.Unmarshal([]byte(strings.TrimPrefix(line, resultPrefix)), result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if result == nil {
+		return nil, ErrNoResult
+	}
+
+	return result, nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"github.com/mouuff/go-rocket-update/pkg/updater"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestUpdater_HandleMigrate(t *testing.T) {
+	tt := map[string]struct {
+		args    []string
+		input   MigrationRegistry
+		handled bool
+		want    interface{}
+	}{
+		"Not Handled": {
+			[]string{"-version"},
+			nil,
+			false,
+			"",
+		},
+		"Success": {
+			[]string{MigrateFlag, FromFlag, "v0.0.1"},
+			nil,
+			true,
+			resultPrefix + `{"status":6}`,
+		},
+		"Bad From": {
+			[]string{MigrateFlag, FromFlag + "=wrong"},
+			nil,
+			true,
+			resultPrefix + `{"status":0,"error":"Malformed version: wrong"}`,
+		},
+		"Migration Error": {
+			[]string{MigrateFlag, FromFlag, "v0.0.1"},
+			MigrationRegistry{
+				&Migration{Version: "v0.0.2", Stage: Patch, CallBackUp: func() error {
+					return fmt.Errorf("error")
+				}, CallBackDown: func() error {
+					return nil
+				}},
+			},
+			true,
+			resultPrefix + `{"status":3,"error":"error"}`,
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			registry := testRegistry(test.input)
+
+			u := Updater{
+				opts:    Options{Registry: registry},
+				version: version.Must(version.NewVersion("v0.0.2")),
+			}
+			buf := &bytes.Buffer{}
+
+			handled, _ := u.HandleMigrate(test.args, buf)
+			assert.Equal(t, test.handled, handled)
+			assert.Equal(t, test.want, string(bytes.TrimSpace(buf.Bytes())))
+		})
+	}
+}
+
+func TestUpdater_Delegate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a shell")
+	}
+
+	tt := map[string]struct {
+		script string
+		want   interface{}
+		code   Status
+	}{
+		"Success": {
+			`echo "some output"; echo '` + resultPrefix + `{"status":6}'`,
+			nil,
+			Updated,
+		},
+		"Migration Error": {
+			`echo '` + resultPrefix + `{"status":1,"error":"db error"}'; exit 1`,
+			"db error",
+			DatabaseError,
+		},
+		"No Result": {
+			`echo "some output"`,
+			ErrNoResult.Error(),
+			ExecutableError,
+		},
+		"Exec Error": {
+			`exit 1`,
+			"exit status 1",
+			ExecutableError,
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			exec := filepath.Join(t.TempDir(), "verbis")
+			assert.NoError(t, ioutil.WriteFile(exec, []byte("#!/bin/sh\n"+test.script+"\n"), 0755))
+
+			u := Updater{
+				opts: Options{Version: "v0.0.1"},
+				pkg:  &updater.Updater{OverrideExecutable: exec},
+			}
+
+			code, err := u.delegate(context.Background())
+			assert.Equal(t, test.code, code)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.Nil(t, test.want)
+		})
+	}
+}
+
+func TestParseMigrateArgs(t *testing.T) {
+	tt := map[string]struct {
+		input []string
+		from  string
+		found bool
+	}{
+		"None": {
+			nil,
+			"",
+			false,
+		},
+		"Separate": {
+			[]string{MigrateFlag, FromFlag, "v0.0.1"},
+			"v0.0.1",
+			true,
+		},
+		"Equals": {
+			[]string{"-other", MigrateFlag, FromFlag + "=v0.0.1"},
+			"v0.0.1",
+			true,
+		},
+		"No Migrate": {
+			[]string{FromFlag, "v0.0.1"},
+			"v0.0.1",
+			false,
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			from, found := parseMigrateArgs(test.input)
+			assert.Equal(t, test.from, from)
+			assert.Equal(t, test.found, found)
+		})
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Dialect describes the database specific behaviour used
+// by the Updater when creating the history table,
+// binding arguments, splitting statements and locking.
+type Dialect interface {
+	// Name returns the name of the dialect such as
+	// "postgres".
+	Name() string
+	// Placeholder returns the bind parameter for the
+	// n-th argument of a query, starting at one.
+	Placeholder(n int) string
+	// CreateHistory returns the statement used to create
+	// the history table if it does not exist.
+	CreateHistory(table string) string
+	// TransactionalDDL reports whether DDL statements can
+	// be rolled back as part of a transaction.
+	TransactionalDDL() bool
+	// Syntax returns the syntax used for splitting
+	// migrations into statements.
+	Syntax() Syntax
+	// Lock acquires an exclusive migration lock using the
+	// connection, waiting up to the timeout passed.
+	// The owner is a random token identifying the
+	// holder. ErrLocked is returned if the lock
+	// could not be obtained in time.
+	Lock(ctx context.Context, conn *sql.Conn, owner string, timeout time.Duration) error
+	// Unlock releases the migration lock of the owner.
+	Unlock(ctx context.Context, conn *sql.Conn, owner string) error
+}
+
+var (
+	// Postgres is the Dialect for PostgreSQL databases.
+	Postgres Dialect = postgres{}
+	// MySQL is the Dialect for MySQL and MariaDB databases.
+	MySQL Dialect = mysql{}
+	// SQLite is the Dialect for SQLite databases.
+	SQLite Dialect = sqlite{}
+)
+
+// driverDialects maps the package paths of database/sql
+// drivers to their dialect.
+var driverDialects = []struct {
+	pkg     string
+	dialect Dialect
+}{
+	{"github.com/jackc/pgx", Postgres},
+	{"github.com/lib/pq", Postgres},
+	{"github.com/go-sql-driver/mysql", MySQL},
+	{"github.com/mattn/go-sqlite3", SQLite},
+	{"modernc.org/sqlite", SQLite},
+}
+
+// detectDialect determines the dialect by the driver of
+// the database, see driverDialect.
+func detectDialect(db *sql.DB) Dialect {
+	return driverDialect(db.Driver())
+}
+
+// driverDialect determines the dialect by the package path
+// of the driver's type, see dialectForPath.
+func driverDialect(d driver.Driver) Dialect {
+	t := reflect.TypeOf(d)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return dialectForPath(t.PkgPath())
+}
+
+// dialectForPath determines the dialect by the package
+// path of a driver, such as
+// "github.com/jackc/pgx/v4/stdlib". The generic
+// dialect is returned if the driver is not
+// recognised.
+func dialectForPath(path string) Dialect {
+	for _, dd := range driverDialects {
+		if strings.Contains(path, dd.pkg) {
+			return dd.dialect
+		}
+	}
+	return generic{}
+}
+
+// dialect returns the dialect from the options, or the
+// generic dialect if there is none set.
+func (u *Updater) dialect() Dialect {
+	if u.opts.Dialect == nil {
+		return generic{}
+	}
+	return u.opts.Dialect
+}
+
+// bind replaces each ? within the query with the
+// placeholders of the dialect.
+func bind(d Dialect, query string) string {
+	var (
+		buf strings.Builder
+		n   = 0
+	)
+	for _, c := range query {
+		if c == '?' {
+			n++
+			buf.WriteString(d.Placeholder(n))
+			continue
+		}
+		buf.WriteRune(c)
+	}
+	return buf.String()
+}
+
+// historyColumns returns the column definitions of the
+// history table using the timestamp type passed.
+func historyColumns(timestamp string) string {
+	return "version VARCHAR(255) NOT NULL, " +
+		"stage VARCHAR(10) NOT NULL, " +
+		"applied_at " + timestamp + " NOT NULL, " +
+		"duration BIGINT NOT NULL, " +
+		"success BOOLEAN NOT NULL, " +
+		"dirty BOOLEAN NOT NULL, " +
+		"checksum VARCHAR(64) NOT NULL DEFAULT ''"
+}
+
+// generic is the dialect used when the database could
+// not be determined. It uses ? placeholders and
+// standard SQL which is supported by most
+// drivers.
+type generic struct{}
+
+func (generic) Name() string           { return "generic" }
+func (generic) Placeholder(int) string { return "?" }
+func (generic) TransactionalDDL() bool { return true }
+func (generic) Syntax() Syntax         { return defaultSyntax }
+func (generic) CreateHistory(table string) string {
+	return "CREATE TABLE IF NOT EXISTS " + table + " (" + historyColumns("TIMESTAMP") + ")"
+}
+
+// postgres is the Dialect for PostgreSQL.
+type postgres struct{}
+
+func (postgres) Name() string             { return "postgres" }
+func (postgres) Placeholder(n int) string { return fmt.Sprintf("$%d", n) }
+func (postgres) TransactionalDDL() bool   { return true }
+func (postgres) Syntax() Syntax {
+	return Syntax{DollarQuotes: true}
+}
+func (postgres) CreateHistory(table string) string {
+	return "CREATE TABLE IF NOT EXISTS " + table + " (" + historyColumns("TIMESTAMP") + ")"
+}
+
+// mysql is the Dialect for MySQL and MariaDB. DDL
+// statements cause an implicit commit so they
+// cannot be rolled back.
+type mysql struct{}
+
+func (mysql) Name() string           { return "mysql" }
+func (mysql) Placeholder(int) string { return "?" }
+func (mysql) TransactionalDDL() bool { return false }
+func (mysql) Syntax() Syntax {
+	return Syntax{BackslashEscapes: true, HashComments: true, Delimiters: true}
+}
+func (mysql) CreateHistory(table string) string {
+	return "CREATE TABLE IF NOT EXISTS " + table + " (" + historyColumns("DATETIME") + ")"
+}
+
+// sqlite is the Dialect for SQLite.
+type sqlite struct{}
+
+func (sqlite) Name() string           { return "sqlite" }
+func (sqlite) Placeholder(int) string { return "?" }
+func (sqlite) TransactionalDDL() bool { return true }
+func (sqlite) Syntax() Syntax {
+	return Syntax{Triggers: true}
+}
+func (sqlite) CreateHistory(table string) string {
+	return "CREATE TABLE IF NOT EXISTS " + table + " (" + historyColumns("TIMESTAMP") + ")"
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBind(t *testing.T) {
+	tt := map[string]struct {
+		dialect Dialect
+		input   string
+		want    string
+	}{
+		"Postgres": {
+			Postgres,
+			"INSERT INTO t (a, b) VALUES (?, ?)",
+			"INSERT INTO t (a, b) VALUES ($1, $2)",
+		},
+		"MySQL": {
+			MySQL,
+			"INSERT INTO t (a, b) VALUES (?, ?)",
+			"INSERT INTO t (a, b) VALUES (?, ?)",
+		},
+		"SQLite": {
+			SQLite,
+			"DELETE FROM t WHERE a = ?",
+			"DELETE FROM t WHERE a = ?",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			got := bind(test.dialect, test.input)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestDialect_CreateHistory(t *testing.T) {
+	tt := map[string]struct {
+		dialect Dialect
+		want    string
+	}{
+		"Generic": {
+			generic{},
+			"applied_at TIMESTAMP NOT NULL",
+		},
+		"Postgres": {
+			Postgres,
+			"applied_at TIMESTAMP NOT NULL",
+		},
+		"MySQL": {
+			MySQL,
+			"applied_at DATETIME NOT NULL",
+		},
+		"SQLite": {
+			SQLite,
+			"applied_at TIMESTAMP NOT NULL",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			got := test.dialect.CreateHistory(historyTable)
+			assert.Contains(t, got, "CREATE TABLE IF NOT EXISTS "+historyTable)
+			assert.Contains(t, got, test.want)
+		})
+	}
+}
+
+func TestDetectDialect(t *testing.T) {
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	got := detectDialect(db)
+	assert.Equal(t, "generic", got.Name())
+}
+
+func TestDialectForPath(t *testing.T) {
+	tt := map[string]struct {
+		input string
+		want  Dialect
+	}{
+		"pgx":       {"github.com/jackc/pgx/v4/stdlib", Postgres},
+		"pq":        {"github.com/lib/pq", Postgres},
+		"MySQL":     {"github.com/go-sql-driver/mysql", MySQL},
+		"go-sqlite": {"github.com/mattn/go-sqlite3", SQLite},
+		"modernc":   {"modernc.org/sqlite", SQLite},
+		"Vendored":  {"example.com/app/vendor/github.com/lib/pq", Postgres},
+		"Unknown":   {"example.com/driver", generic{}},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			got := dialectForPath(test.input)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestUpdater_Dialect(t *testing.T) {
+	u := Updater{}
+	assert.Equal(t, generic{}, u.dialect())
+
+	u.opts.Dialect = Postgres
+	assert.Equal(t, Postgres, u.dialect())
+}
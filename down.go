@@ -0,0 +1,238 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"sort"
+)
+
+var (
+	// ErrMigrationNotFound is returned by MigrateDown when
+	// a version recorded in the history has no
+	// corresponding migration in the registry.
+	ErrMigrationNotFound = errors.New("migration not found in registry")
+	// ErrIrreversible is returned by MigrateDown when a
+	// migration has up SQL but no SQLDown to
+	// reverse it.
+	ErrIrreversible = errors.New("migration has no down sql")
+)
+
+// MigrateDown reverses every migration that has been
+// applied above the target version in descending
+// order. SQLDown and CallBackDown are executed for
+// each migration and the history rows are removed
+// using the transaction mode of the migration. If
+// there was an error the transaction is rolled
+// back and the CallBackUp of any reversed
+// migrations are called to restore the
+// previous state.
+func (u *Updater) MigrateDown(target string) (Status, error) {
+	return u.MigrateDownContext(context.Background(), target)
+}
+
+// MigrateDownContext is MigrateDown with a context that
+// bounds acquiring the lock and reversing the
+// migrations.
+func (u *Updater) MigrateDownContext(ctx context.Context, target string) (Status, error) {
+	ver, err := version.NewVersion(target)
+	if err != nil {
+		return Unknown, err
+	}
+
+	return u.withLock(ctx, func() (Status, error) {
+		return u.migrateDown(ctx, ver)
+	})
+}
+
+// migrateDown reverses the migrations down to the target,
+// see MigrateDown.
+func (u *Updater) migrateDown(ctx context.Context, ver *version.Version) (Status, error) {
+	var (
+		err     error
+		applied history
+	)
+
+	if u.opts.hasDB {
+		applied, err = u.history(ctx)
+		if err != nil {
+			return DatabaseError, err
+		}
+
+		err = applied.checkDirty()
+		if err != nil {
+			return Dirty, err
+		}
+	}
+
+	reversible, err := u.reversible(applied, ver)
+	if err != nil {
+		return Unknown, err
+	}
+
+	if len(reversible) == 0 {
+		return UpToDate, nil
+	}
+
+	b := u.newBatch(ctx, applied.start(u.version), ver)
+	for _, migration := range reversible {
+		code, err := b.run(migration, func(ex execer) (Status, error) {
+			return u.reverse(b, migration, ex)
+		})
+		if err != nil {
+			return u.failDown(b, migration, code, err)
+		}
+	}
+
+	err = b.commit()
+	if err != nil {
+		last := b.uncommitted[len(b.uncommitted)-1]
+		return u.failDown(b, last, DatabaseError, err)
+	}
+
+	return Downgraded, nil
+}
+
+// reversible returns the migrations that are newer than
+// the target and have been applied, sorted in
+// descending order. The current version is
+// determined from the history in the same way
+// as pending.
+func (u *Updater) reversible(h history, target *version.Version) (MigrationRegistry, error) {
+	current := h.start(u.version)
+
+	registry := u.registry()
+
+	var reversible MigrationRegistry
+	for _, migration := range registry.All() {
+		semver := migration.toSemVer()
+		if !target.LessThan(semver) || semver.GreaterThan(current) {
+			continue
+		}
+		if migration.irreversible() {
+			return nil, fmt.Errorf("%w: %s", ErrIrreversible, migration.Version)
+		}
+		reversible = append(reversible, migration)
+	}
+
+	for _, r := range h {
+		ver, err := version.NewVersion(r.Version)
+		if err != nil || !r.Success || !target.LessThan(ver) {
+			continue
+		}
+		if _, err := registry.Get(r.Version); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrMigrationNotFound, r.Version)
+		}
+	}
+
+	sort.Sort(sort.Reverse(reversible))
+
+	return reversible, nil
+}
+
+// failDown rolls back the batch after a migration failed
+// to be reversed. Migrations that have already been
+// committed cannot be restored, so the database is
+// marked as dirty if there are any, or if the
+// rollback failed.
+func (u *Updater) failDown(b *batch, m *Migration, code Status, err error) (Status, error) {
+	var rollForwardErr error
+	if !b.partial {
+		rollForwardErr = u.rollForward(b)
+	}
+
+	if b.partial || len(b.committed) > 0 || rollForwardErr != nil {
+		if u.opts.hasDB {
+			// In a dirty state, further updates are refused
+			// until ForceVersion is called.
+			record := u.newRecord(m, 0, false)
+			record.Dirty = true
+			_ = u.record(context.Background(), u.opts.DB, record)
+		}
+		if b.partial || len(b.committed) > 0 {
+			code = Dirty
+		}
+	}
+
+	if rollForwardErr != nil {
+		return code, rollForwardErr
+	}
+
+	return code, err
+}
+
+// reverse executes the SQLDown and Down function of the
+// migration, removes the migration from the history
+// and calls the CallBackDown function if there is
+// one set and the context has not been
+// cancelled.
+func (u *Updater) reverse(b *batch, m *Migration, ex execer) (Status, error) {
+	ctx := b.ctx
+
+	migration, err := readSQL(m.SQLDown)
+	if err != nil {
+		return Unknown, err
+	}
+
+	if u.opts.hasDB && migration != "" {
+		err = execStatements(ctx, ex, u.dialect().Syntax(), m.Version, migration)
+		if err != nil {
+			return DatabaseError, err
+		}
+	}
+
+	if m.Down != nil {
+		err := m.Down(u.migrationContext(b, m, ex))
+		if err != nil {
+			return CallBackError, err
+		}
+	}
+
+	if u.opts.hasDB {
+		err = u.forget(ctx, ex, m)
+		if err != nil {
+			return DatabaseError, err
+		}
+	}
+
+	if m.hasCallBack() {
+		if ctx.Err() != nil {
+			return Unknown, ctx.Err()
+		}
+		err := m.CallBackDown()
+		if err != nil {
+			return CallBackError, err
+		}
+	}
+
+	return Downgraded, nil
+}
+
+// rollForward rolls back the shared transaction (if
+// there is one) and calls CallBackUp for the
+// uncommitted migrations in the opposite
+// order in which they were reversed.
+func (u *Updater) rollForward(b *batch) error {
+	err := b.rollback()
+	if err != nil {
+		return err
+	}
+
+	for i := len(b.uncommitted) - 1; i >= 0; i-- {
+		m := b.uncommitted[i]
+		if !m.hasCallBack() {
+			continue
+		}
+		err := m.CallBackUp()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
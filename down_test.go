@@ -0,0 +1,226 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+const (
+	v001Down = "UPDATE my_table SET name = 'bob' WHERE id = 1"
+	v002Down = "UPDATE my_table SET name = 'james' WHERE id = 2"
+)
+
+// expectForget adds the expectation for removing a
+// version from the history table.
+func expectForget(m sqlmock.Sqlmock, version string) *sqlmock.ExpectedExec {
+	return m.ExpectExec("DELETE FROM " + historyTable).
+		WithArgs(version).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestUpdater_MigrateDown(t *testing.T) {
+	tt := map[string]struct {
+		input  MigrationRegistry
+		target string
+		mock   func(m sqlmock.Sqlmock)
+		want   interface{}
+		code   Status
+	}{
+		"Simple": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), SQLDown: strings.NewReader(v001Down), Stage: Patch},
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), SQLDown: strings.NewReader(v002Down), Stage: Patch},
+			},
+			"v0.0.0",
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.1", "v0.0.2")
+				m.ExpectBegin()
+				m.ExpectExec(v002Down).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectForget(m, "v0.0.2")
+				m.ExpectExec(v001Down).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectForget(m, "v0.0.1")
+				m.ExpectCommit()
+			},
+			nil,
+			Downgraded,
+		},
+		"Partial": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), SQLDown: strings.NewReader(v001Down), Stage: Patch},
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), SQLDown: strings.NewReader(v002Down), Stage: Patch},
+			},
+			"v0.0.1",
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.1", "v0.0.2")
+				m.ExpectBegin()
+				m.ExpectExec(v002Down).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectForget(m, "v0.0.2")
+				m.ExpectCommit()
+			},
+			nil,
+			Downgraded,
+		},
+		"Up To Date": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), SQLDown: strings.NewReader(v001Down), Stage: Patch},
+			},
+			"v0.0.1",
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.1")
+			},
+			nil,
+			UpToDate,
+		},
+		"Bad Target": {
+			nil,
+			"wrong",
+			nil,
+			"Malformed version",
+			Unknown,
+		},
+		"Irreversible": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Patch},
+			},
+			"v0.0.0",
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.1")
+			},
+			ErrIrreversible.Error(),
+			Unknown,
+		},
+		"Not Registered": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), SQLDown: strings.NewReader(v001Down), Stage: Patch},
+			},
+			"v0.0.0",
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.1", "v0.0.2")
+			},
+			ErrMigrationNotFound.Error(),
+			Unknown,
+		},
+		"Exec Error": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), SQLDown: strings.NewReader(v001Down), Stage: Patch},
+			},
+			"v0.0.0",
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.1")
+				m.ExpectBegin()
+				m.ExpectExec(v001Down).
+					WillReturnError(fmt.Errorf("error"))
+				m.ExpectRollback()
+			},
+			"error",
+			DatabaseError,
+		},
+		"Callback Error": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", Stage: Patch, CallBackUp: func() error {
+					return fmt.Errorf("up error")
+				}, CallBackDown: func() error {
+					return nil
+				}},
+				&Migration{Version: "v0.0.2", Stage: Patch, CallBackUp: func() error {
+					return nil
+				}, CallBackDown: func() error {
+					return fmt.Errorf("down error")
+				}},
+			},
+			"v0.0.0",
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.1", "v0.0.2")
+				m.ExpectBegin()
+				expectForget(m, "v0.0.2")
+				m.ExpectRollback()
+			},
+			"down error",
+			CallBackError,
+		},
+		"Commit Error": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), SQLDown: strings.NewReader(v001Down), Stage: Patch},
+			},
+			"v0.0.0",
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.1")
+				m.ExpectBegin()
+				m.ExpectExec(v001Down).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectForget(m, "v0.0.1")
+				m.ExpectCommit().
+					WillReturnError(fmt.Errorf("error"))
+			},
+			"error",
+			DatabaseError,
+		},
+		"Final Commit Error": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), SQLDown: strings.NewReader(v001Down), Stage: Patch},
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), SQLDown: strings.NewReader(v002Down), Stage: Patch, Transaction: TxOwn},
+			},
+			"v0.0.0",
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.1", "v0.0.2")
+				m.ExpectBegin()
+				m.ExpectExec(v002Down).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectForget(m, "v0.0.2")
+				m.ExpectCommit()
+				m.ExpectBegin()
+				m.ExpectExec(v001Down).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectForget(m, "v0.0.1")
+				m.ExpectCommit().
+					WillReturnError(fmt.Errorf("error"))
+				m.ExpectExec("INSERT INTO "+historyTable).
+					WithArgs("v0.0.1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), false, true, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			"error",
+			Dirty,
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+
+			if test.mock != nil {
+				test.mock(mock)
+			}
+
+			defer db.Close()
+
+			u := Updater{
+				opts:    Options{DB: db, hasDB: true, Registry: testRegistry(test.input)},
+				version: version.Must(version.NewVersion("0.0.0")),
+			}
+
+			code, err := u.MigrateDown(test.target)
+			assert.Equal(t, test.code, code)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("there were unfulfilled expectations: %s", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Drift describes an applied migration whose SQL no
+// longer matches the checksum recorded in the
+// history table.
+type Drift struct {
+	// The version of the migration.
+	Version string `json:"version"`
+	// The checksum recorded when the migration was
+	// applied.
+	Applied string `json:"applied"`
+	// The checksum of the SQL in the registry.
+	Current string `json:"current"`
+}
+
+var (
+	// ErrDrift is returned when RefuseDrift is set and the
+	// SQL of an applied migration has changed.
+	ErrDrift = errors.New("applied migration has changed")
+)
+
+// Drift compares the SQL of the migrations in the
+// registry against the checksums recorded in the
+// history and returns any mismatches. Records
+// without a checksum, or versions that are no
+// longer in the registry are skipped. Nil is
+// returned if there is no database.
+func (u *Updater) Drift() ([]Drift, error) {
+	if !u.opts.hasDB {
+		return nil, nil
+	}
+	h, err := u.history(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return h.drift(u.registry())
+}
+
+// drift returns the applied migrations whose SQL differs
+// from the checksum recorded in the registry passed,
+// see Drift.
+func (h history) drift(r *Registry) ([]Drift, error) {
+	var drifted []Drift
+	for _, rec := range h {
+		if !rec.Success || rec.Dirty || rec.Checksum == "" {
+			continue
+		}
+		m, err := r.Get(rec.Version)
+		if err != nil {
+			continue
+		}
+		sum, err := m.checksum()
+		if err != nil {
+			return nil, err
+		}
+		if sum != rec.Checksum {
+			drifted = append(drifted, Drift{Version: rec.Version, Applied: rec.Checksum, Current: sum})
+		}
+	}
+	return drifted, nil
+}
+
+// checkDrift returns ErrDrift with the versions that have
+// changed if the history has drifted from the
+// registry passed.
+func (h history) checkDrift(r *Registry) error {
+	drifted, err := h.drift(r)
+	if err != nil {
+		return err
+	}
+	if len(drifted) == 0 {
+		return nil
+	}
+	versions := make([]string, len(drifted))
+	for i, d := range drifted {
+		versions[i] = d.Version
+	}
+	return fmt.Errorf("%w: %s", ErrDrift, strings.Join(versions, ", "))
+}
+
+// checkDrift returns ErrDrift if the history has drifted
+// from the registry, nil is returned if there is no
+// database.
+func (u *Updater) checkDrift(ctx context.Context) error {
+	if !u.opts.hasDB {
+		return nil
+	}
+	h, err := u.history(ctx)
+	if err != nil {
+		return err
+	}
+	return h.checkDrift(u.registry())
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// checksumOf returns the checksum of the SQL passed.
+func checksumOf(t *testing.T, sql string) string {
+	t.Helper()
+	sum, err := (&Migration{SQL: strings.NewReader(sql)}).checksum()
+	assert.NoError(t, err)
+	return sum
+}
+
+// expectChecksumHistory adds the expectations for
+// retrieving the history table with a successful
+// record for the version and checksum passed.
+func expectChecksumHistory(m sqlmock.Sqlmock, version, checksum string) {
+	m.ExpectExec("CREATE TABLE IF NOT EXISTS " + historyTable).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	m.ExpectQuery("SELECT version, success, dirty, checksum FROM " + historyTable).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "success", "dirty", "checksum"}).
+			AddRow(version, true, false, checksum))
+}
+
+func TestUpdater_Drift(t *testing.T) {
+	tt := map[string]struct {
+		db   bool
+		mock func(t *testing.T, m sqlmock.Sqlmock)
+		want interface{}
+	}{
+		"No DB": {
+			false,
+			nil,
+			[]Drift(nil),
+		},
+		"Match": {
+			true,
+			func(t *testing.T, m sqlmock.Sqlmock) {
+				expectChecksumHistory(m, "v0.0.1", checksumOf(t, v001))
+			},
+			[]Drift(nil),
+		},
+		"No Checksum": {
+			true,
+			func(t *testing.T, m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.1")
+			},
+			[]Drift(nil),
+		},
+		"Unknown Version": {
+			true,
+			func(t *testing.T, m sqlmock.Sqlmock) {
+				expectChecksumHistory(m, "v0.0.9", "wrong")
+			},
+			[]Drift(nil),
+		},
+		"Drifted": {
+			true,
+			func(t *testing.T, m sqlmock.Sqlmock) {
+				expectChecksumHistory(m, "v0.0.1", "wrong")
+			},
+			[]Drift{{Version: "v0.0.1", Applied: "wrong", Current: "checksum"}},
+		},
+		"Error": {
+			true,
+			func(t *testing.T, m sqlmock.Sqlmock) {
+				m.ExpectExec("CREATE TABLE IF NOT EXISTS " + historyTable).
+					WillReturnError(fmt.Errorf("error"))
+			},
+			"error",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			if test.mock != nil {
+				test.mock(t, mock)
+			}
+
+			registry := testRegistry(MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Patch},
+			})
+
+			u := Updater{opts: Options{DB: db, hasDB: test.db, Registry: registry}}
+			got, err := u.Drift()
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+
+			if want, ok := test.want.([]Drift); ok && len(want) > 0 {
+				want[0].Current = checksumOf(t, v001)
+			}
+			assert.Equal(t, test.want, got)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdater_RunDrift(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	expectChecksumHistory(mock, "v0.0.1", "wrong")
+
+	registry := testRegistry(MigrationRegistry{
+		&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Patch},
+		&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), Stage: Patch},
+	})
+
+	u := Updater{
+		opts:    Options{DB: db, hasDB: true, RefuseDrift: true, Registry: registry},
+		version: version.Must(version.NewVersion("v0.0.1")),
+	}
+
+	code, err := u.runMigrations(context.Background(), u.version, version.Must(version.NewVersion("v0.0.2")))
+	assert.Equal(t, Status(Drifted), code)
+	assert.ErrorIs(t, err, ErrDrift)
+	assert.Contains(t, err.Error(), "v0.0.1")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GiteaSource is a Source that retrieves the releases of
+// a repository on a Gitea instance. Archives are the
+// attachments of each release.
+type GiteaSource struct {
+	// The base URL of the Gitea instance such as
+	// "https://gitea.example.com".
+	BaseURL string
+	// The owner of the repository.
+	Owner string
+	// The name of the repository.
+	Repo string
+	// The access token used for private repositories, it
+	// is only sent to the Gitea instance.
+	Token string
+	// The client used for requests, http.DefaultClient is
+	// used if nil.
+	Client *http.Client
+}
+
+var (
+	// ErrGiteaRepository is returned by GiteaSource when the
+	// base URL, owner or repository is not set.
+	ErrGiteaRepository = errors.New("invalid gitea repository")
+)
+
+// giteaRelease is a release returned by the Gitea
+// releases API.
+type giteaRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name               string `json:"name"`
+		BrowserDownloadURL string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// base returns the base URL of the Gitea instance.
+func (g *GiteaSource) base() (string, error) {
+	if g.BaseURL == "" || g.Owner == "" || g.Repo == "" {
+		return "", fmt.Errorf("%w: base url, owner and repo are required", ErrGiteaRepository)
+	}
+	return strings.TrimSuffix(g.BaseURL, "/"), nil
+}
+
+// api returns the URL of the repository endpoint of the
+// Gitea API with the path appended.
+func (g *GiteaSource) api(path string) (string, error) {
+	base, err := g.base()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/api/v1/repos/%s/%s%s", base, url.PathEscape(g.Owner), url.PathEscape(g.Repo), path), nil
+}
+
+// header returns the headers of requests to the Gitea
+// instance.
+func (g *GiteaSource) header() http.Header {
+	header := http.Header{}
+	if g.Token != "" {
+		header.Set("Authorization", "token "+g.Token)
+	}
+	return header
+}
+
+// Releases retrieves the tags of the releases of the
+// repository, newest first.
+func (g *GiteaSource) Releases(ctx context.Context) ([]string, error) {
+	endpoint, err := g.api("/releases?draft=false")
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []giteaRelease
+	err = sourceGetJSON(ctx, g.Client, endpoint, g.header(), &releases)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, len(releases))
+	for i, r := range releases {
+		tags[i] = r.TagName
+	}
+
+	return tags, nil
+}
+
+// LatestVersion retrieves the tag of the most recent
+// release of the repository.
+func (g *GiteaSource) LatestVersion(ctx context.Context) (string, error) {
+	releases, err := g.Releases(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if len(releases) == 0 {
+		return "", fmt.Errorf("no releases found for %s/%s", g.Owner, g.Repo)
+	}
+
+	return releases[0], nil
+}
+
+// URL returns the download URL of the release attachment
+// using the owner and repository name.
+func (g *GiteaSource) URL(version, archive string) (string, error) {
+	base, err := g.base()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%s/%s/releases/download/%s/%s", base, url.PathEscape(g.Owner), url.PathEscape(g.Repo), url.PathEscape(version), url.PathEscape(archive)), nil
+}
+
+// Open downloads the attachment of the release with the
+// name of the archive.
+func (g *GiteaSource) Open(ctx context.Context, version, archive string) (io.ReadCloser, error) {
+	endpoint, err := g.api("/releases/tags/" + url.PathEscape(version))
+	if err != nil {
+		return nil, err
+	}
+
+	var release giteaRelease
+	err = sourceGetJSON(ctx, g.Client, endpoint, g.header(), &release)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, asset := range release.Assets {
+		if asset.Name != archive {
+			continue
+		}
+
+		header := http.Header{}
+		if sameHost(asset.BrowserDownloadURL, endpoint) {
+			header = g.header()
+		}
+
+		resp, err := sourceGet(ctx, g.Client, asset.BrowserDownloadURL, header)
+		if err != nil {
+			return nil, err
+		}
+
+		return resp.Body, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s for version %s in %s/%s", ErrNoRelease, archive, version, g.Owner, g.Repo)
+}
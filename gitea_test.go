@@ -0,0 +1,143 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"github.com/mouuff/go-rocket-update/pkg/updater"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testGitea returns a stand-in of the Gitea releases API
+// for the repository "owner/verbis". Requests must
+// have the token "secret".
+func testGitea(archive []byte) *httptest.Server {
+	mux := http.NewServeMux()
+	var ts *httptest.Server
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/v1/repos/owner/verbis/releases":
+			_, _ = w.Write([]byte(`[{"tag_name": "v0.0.2"}, {"tag_name": "v0.0.1"}]`))
+		case "/api/v1/repos/owner/verbis/releases/tags/v0.0.2":
+			_, _ = fmt.Fprintf(w, `{"tag_name": "v0.0.2", "assets": [
+				{"name": "verbis.zip", "browser_download_url": "%s/owner/verbis/releases/download/v0.0.2/verbis.zip"}
+			]}`, ts.URL)
+		case "/owner/verbis/releases/download/v0.0.2/verbis.zip":
+			_, _ = w.Write(archive)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	ts = httptest.NewServer(mux)
+	return ts
+}
+
+func TestGiteaSource(t *testing.T) {
+	ts := testGitea([]byte("archive"))
+	defer ts.Close()
+
+	tt := map[string]struct {
+		source  GiteaSource
+		archive string
+		want    interface{}
+	}{
+		"Success": {
+			GiteaSource{BaseURL: ts.URL, Owner: "owner", Repo: "verbis", Token: "secret"},
+			"verbis.zip",
+			"archive",
+		},
+		"Not Found": {
+			GiteaSource{BaseURL: ts.URL, Owner: "owner", Repo: "verbis", Token: "secret"},
+			"wrong.zip",
+			ErrNoRelease.Error(),
+		},
+		"Unauthorised": {
+			GiteaSource{BaseURL: ts.URL, Owner: "owner", Repo: "verbis"},
+			"verbis.zip",
+			"401",
+		},
+		"No Repo": {
+			GiteaSource{BaseURL: ts.URL, Owner: "owner"},
+			"verbis.zip",
+			ErrGiteaRepository.Error(),
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			latest, err := test.source.LatestVersion(context.Background())
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.Equal(t, "v0.0.2", latest)
+
+			releases, err := test.source.Releases(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"v0.0.2", "v0.0.1"}, releases)
+
+			rc, err := test.source.Open(context.Background(), latest, test.archive)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			defer rc.Close()
+			got, err := ioutil.ReadAll(rc)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, string(got))
+		})
+	}
+}
+
+func TestGiteaSource_URL(t *testing.T) {
+	g := &GiteaSource{BaseURL: "https://gitea.example.com/", Owner: "owner", Repo: "verbis"}
+	got, err := g.URL("v0.0.2", "verbis.zip")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://gitea.example.com/owner/verbis/releases/download/v0.0.2/verbis.zip", got)
+
+	_, err = (&GiteaSource{}).URL("v0.0.2", "verbis.zip")
+	assert.ErrorIs(t, err, ErrGiteaRepository)
+}
+
+func TestGiteaSource_Update(t *testing.T) {
+	ts := testGitea(testArchive(t, map[string]string{"verbis": "new"}))
+	defer ts.Close()
+
+	exec := filepath.Join(t.TempDir(), "verbis")
+	assert.NoError(t, ioutil.WriteFile(exec, []byte("old"), os.ModePerm))
+
+	u := Updater{
+		opts: Options{
+			Version:  "v0.0.1",
+			Source:   &GiteaSource{BaseURL: ts.URL, Owner: "owner", Repo: "verbis", Token: "secret"},
+			Registry: NewRegistry(),
+		},
+		pkg:     &updater.Updater{OverrideExecutable: exec},
+		version: version.Must(version.NewVersion("v0.0.1")),
+	}
+
+	status, err := u.Update("verbis.zip")
+	assert.NoError(t, err)
+	assert.Equal(t, Status(Updated), status)
+
+	got, err := ioutil.ReadFile(exec)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(got))
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+)
+
+// githubDownloadURL is the base URL used for downloading
+// release assets from GitHub.
+var githubDownloadURL = "https://github.com"
+
+// githubAPIURL is the base URL of the GitHub API used for
+// retrieving the tags of a repository.
+var githubAPIURL = "https://api.github.com"
+
+// GithubSource is a Source that retrieves the tagged
+// releases of a public GitHub repository.
+type GithubSource struct {
+	// The URL of the GitHub Repository to obtain the
+	// executable from.
+	RepositoryURL string
+	// The client used for requests, http.DefaultClient is
+	// used if nil.
+	Client *http.Client
+}
+
+var (
+	// ErrGithubURL is returned by GithubSource when the
+	// repository URL could not be parsed.
+	ErrGithubURL = errors.New("invalid github url")
+)
+
+// githubRepository returns the owner and repository
+// name from the URL of a GitHub repository.
+func githubRepository(url string) (string, string, error) {
+	re := regexp.MustCompile(`github\.com/(.*?)/(.*?)$`)
+	matches := re.FindStringSubmatch(url)
+	if len(matches) < 3 {
+		return "", "", fmt.Errorf("%w: %s", ErrGithubURL, url)
+	}
+	return matches[1], matches[2], nil
+}
+
+// Releases retrieves the tags of the repository, newest
+// first.
+func (g *GithubSource) Releases(ctx context.Context) ([]string, error) {
+	owner, repo, err := githubRepository(g.RepositoryURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []struct {
+		Name string `json:"name"`
+	}
+	err = sourceGetJSON(ctx, g.Client, fmt.Sprintf("%s/repos/%s/%s/tags", githubAPIURL, owner, repo), nil, &tags)
+	if err != nil {
+		return nil, err
+	}
+
+	releases := make([]string, len(tags))
+	for i, tag := range tags {
+		releases[i] = tag.Name
+	}
+
+	return releases, nil
+}
+
+// LatestVersion retrieves the most recent tag of the
+// repository.
+func (g *GithubSource) LatestVersion(ctx context.Context) (string, error) {
+	releases, err := g.Releases(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if len(releases) == 0 {
+		return "", fmt.Errorf("no tags found for %s", g.RepositoryURL)
+	}
+
+	return releases[0], nil
+}
+
+// URL returns the download URL for the release asset
+// using the owner and repository name.
+func (g *GithubSource) URL(version, archive string) (string, error) {
+	owner, repo, err := githubRepository(g.RepositoryURL)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/%s/%s/releases/download/%s/%s", githubDownloadURL, owner, repo, version, archive), nil
+}
+
+// Open downloads the release asset.
+func (g *GithubSource) Open(ctx context.Context, version, archive string) (io.ReadCloser, error) {
+	url, err := g.URL(version, archive)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := sourceGet(ctx, g.Client, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
@@ -0,0 +1,256 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testRelease serves the archive passed using a test
+// server and points githubDownloadURL to it. The
+// returned function restores the original URL.
+func testRelease(t *testing.T, archive []byte, status int) func() {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write(archive)
+	}))
+	original := githubDownloadURL
+	githubDownloadURL = ts.URL
+	return func() {
+		githubDownloadURL = original
+		ts.Close()
+	}
+}
+
+// testArchive returns the bytes of a zip archive
+// containing the files passed.
+func testArchive(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		assert.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestGithubSource_URL(t *testing.T) {
+	tt := map[string]struct {
+		input GithubSource
+		want  interface{}
+	}{
+		"Success": {
+			GithubSource{RepositoryURL: "https://github.com/ainsleyclark/verbis"},
+			"https://github.com/ainsleyclark/verbis/releases/download/v0.0.1/verbis.zip",
+		},
+		"Bad URL": {
+			GithubSource{RepositoryURL: "https://gitlab.com/verbis"},
+			ErrGithubURL.Error(),
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			got, err := test.input.URL("v0.0.1", "verbis.zip")
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestSourceRelease_Open(t *testing.T) {
+	tt := map[string]struct {
+		archive string
+		status  int
+		want    interface{}
+	}{
+		"Success": {
+			"verbis.zip",
+			http.StatusOK,
+			"exec",
+		},
+		"Not Found": {
+			"verbis.zip",
+			http.StatusNotFound,
+			"404",
+		},
+		"Bad Archive": {
+			"verbis.rar",
+			http.StatusOK,
+			"unknown file type",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			teardown := testRelease(t, testArchive(t, map[string]string{"verbis": "exec"}), test.status)
+			defer teardown()
+
+			tmp := t.TempDir()
+			original := os.Getenv("TMPDIR")
+			assert.NoError(t, os.Setenv("TMPDIR", tmp))
+			defer os.Setenv("TMPDIR", original)
+
+			g := &sourceRelease{
+				source:  &GithubSource{RepositoryURL: "https://github.com/ainsleyclark/verbis"},
+				archive: test.archive,
+				version: "v0.0.1",
+			}
+			defer g.Close()
+
+			err := g.Open()
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				entries, readErr := ioutil.ReadDir(tmp)
+				assert.NoError(t, readErr)
+				assert.Empty(t, entries, "The temporary directory should be removed")
+				return
+			}
+
+			dest := filepath.Join(t.TempDir(), "verbis")
+			assert.NoError(t, g.Retrieve("verbis", dest))
+			got, err := ioutil.ReadFile(dest)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, string(got))
+		})
+	}
+}
+
+func TestSourceRelease_OpenCancelled(t *testing.T) {
+	teardown := testRelease(t, testArchive(t, map[string]string{"verbis": "exec"}), http.StatusOK)
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	g := &sourceRelease{
+		source:  &GithubSource{RepositoryURL: "https://github.com/ainsleyclark/verbis"},
+		archive: "verbis.zip",
+		version: "v0.0.1",
+		ctx:     ctx,
+	}
+	defer g.Close()
+
+	err := g.Open()
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestGithubSource_LatestVersion(t *testing.T) {
+	tt := map[string]struct {
+		url    string
+		body   string
+		status int
+		want   interface{}
+	}{
+		"Success": {
+			"https://github.com/ainsleyclark/verbis",
+			`[{"name": "v0.0.2"}, {"name": "v0.0.1"}]`,
+			http.StatusOK,
+			"v0.0.2",
+		},
+		"No Tags": {
+			"https://github.com/ainsleyclark/verbis",
+			`[]`,
+			http.StatusOK,
+			"no tags found",
+		},
+		"Bad Status": {
+			"https://github.com/ainsleyclark/verbis",
+			``,
+			http.StatusForbidden,
+			"403",
+		},
+		"Bad JSON": {
+			"https://github.com/ainsleyclark/verbis",
+			`wrong`,
+			http.StatusOK,
+			"invalid character",
+		},
+		"Bad URL": {
+			"https://gitlab.com/verbis",
+			``,
+			http.StatusOK,
+			ErrGithubURL.Error(),
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/repos/ainsleyclark/verbis/tags", r.URL.Path)
+				w.WriteHeader(test.status)
+				_, _ = w.Write([]byte(test.body))
+			}))
+			defer ts.Close()
+
+			original := githubAPIURL
+			githubAPIURL = ts.URL
+			defer func() {
+				githubAPIURL = original
+			}()
+
+			got, err := (&GithubSource{RepositoryURL: test.url}).LatestVersion(context.Background())
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestGithubSource_Releases(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"name": "v0.0.2"}, {"name": "v0.0.1"}]`))
+	}))
+	defer ts.Close()
+
+	original := githubAPIURL
+	githubAPIURL = ts.URL
+	defer func() {
+		githubAPIURL = original
+	}()
+
+	got, err := (&GithubSource{RepositoryURL: "https://github.com/ainsleyclark/verbis"}).Releases(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v0.0.2", "v0.0.1"}, got)
+}
+
+func TestGithubSource_Client(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"name": "v0.0.2"}]`))
+	}))
+	defer ts.Close()
+
+	original := githubAPIURL
+	githubAPIURL = ts.URL
+	defer func() {
+		githubAPIURL = original
+	}()
+
+	g := &GithubSource{RepositoryURL: "https://github.com/ainsleyclark/verbis"}
+	_, err := g.Releases(context.Background())
+	assert.Error(t, err, "The default client should not trust the test server")
+
+	g.Client = ts.Client()
+	got, err := g.Releases(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v0.0.2"}, got)
+}
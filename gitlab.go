@@ -0,0 +1,156 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultGitlabURL is the base URL used by GitlabSource
+// when none is set.
+const DefaultGitlabURL = "https://gitlab.com"
+
+// GitlabSource is a Source that retrieves the releases of
+// a GitLab project, either on gitlab.com or a self
+// hosted instance. Archives are the asset links
+// of each release.
+type GitlabSource struct {
+	// The base URL of the GitLab instance, defaults to
+	// DefaultGitlabURL.
+	BaseURL string
+	// The path of the project such as "group/my-repo".
+	Project string
+	// The access token used for private projects, it is
+	// only sent to the GitLab instance.
+	Token string
+	// The client used for requests, http.DefaultClient is
+	// used if nil.
+	Client *http.Client
+}
+
+var (
+	// ErrGitlabProject is returned by GitlabSource when no
+	// project is set.
+	ErrGitlabProject = errors.New("no gitlab project provided")
+)
+
+// gitlabRelease is a release returned by the GitLab
+// releases API.
+type gitlabRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  struct {
+		Links []struct {
+			Name           string `json:"name"`
+			URL            string `json:"url"`
+			DirectAssetURL string `json:"direct_asset_url"`
+		} `json:"links"`
+	} `json:"assets"`
+}
+
+// api returns the URL of the project endpoint of the
+// GitLab API with the path appended.
+func (g *GitlabSource) api(path string) (string, error) {
+	if g.Project == "" {
+		return "", ErrGitlabProject
+	}
+	base := g.BaseURL
+	if base == "" {
+		base = DefaultGitlabURL
+	}
+	return fmt.Sprintf("%s/api/v4/projects/%s%s", strings.TrimSuffix(base, "/"), url.PathEscape(g.Project), path), nil
+}
+
+// header returns the headers of requests to the GitLab
+// instance.
+func (g *GitlabSource) header() http.Header {
+	header := http.Header{}
+	if g.Token != "" {
+		header.Set("PRIVATE-TOKEN", g.Token)
+	}
+	return header
+}
+
+// Releases retrieves the tags of the releases of the
+// project, newest first.
+func (g *GitlabSource) Releases(ctx context.Context) ([]string, error) {
+	endpoint, err := g.api("/releases?per_page=100")
+	if err != nil {
+		return nil, err
+	}
+
+	var releases []gitlabRelease
+	err = sourceGetJSON(ctx, g.Client, endpoint, g.header(), &releases)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, len(releases))
+	for i, r := range releases {
+		tags[i] = r.TagName
+	}
+
+	return tags, nil
+}
+
+// LatestVersion retrieves the tag of the most recent
+// release of the project.
+func (g *GitlabSource) LatestVersion(ctx context.Context) (string, error) {
+	releases, err := g.Releases(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if len(releases) == 0 {
+		return "", fmt.Errorf("no releases found for %s", g.Project)
+	}
+
+	return releases[0], nil
+}
+
+// Open downloads the asset link of the release with the
+// name of the archive.
+func (g *GitlabSource) Open(ctx context.Context, version, archive string) (io.ReadCloser, error) {
+	endpoint, err := g.api("/releases/" + url.PathEscape(version))
+	if err != nil {
+		return nil, err
+	}
+
+	var release gitlabRelease
+	err = sourceGetJSON(ctx, g.Client, endpoint, g.header(), &release)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, link := range release.Assets.Links {
+		if link.Name != archive {
+			continue
+		}
+
+		download := link.DirectAssetURL
+		if download == "" {
+			download = link.URL
+		}
+
+		header := http.Header{}
+		if sameHost(download, endpoint) {
+			header = g.header()
+		}
+
+		resp, err := sourceGet(ctx, g.Client, download, header)
+		if err != nil {
+			return nil, err
+		}
+
+		return resp.Body, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s for version %s in %s", ErrNoRelease, archive, version, g.Project)
+}
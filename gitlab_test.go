@@ -0,0 +1,126 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testGitlab returns a stand-in of the GitLab releases API
+// for the project "group/verbis". Requests must have
+// the token "secret" unless they are for the asset
+// hosted elsewhere.
+func testGitlab(external string) *httptest.Server {
+	mux := http.NewServeMux()
+	var ts *httptest.Server
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/group%2Fverbis/releases":
+			_, _ = w.Write([]byte(`[{"tag_name": "v0.0.2"}, {"tag_name": "v0.0.1"}]`))
+		case "/api/v4/projects/group%2Fverbis/releases/v0.0.2":
+			_, _ = fmt.Fprintf(w, `{"tag_name": "v0.0.2", "assets": {"links": [
+				{"name": "verbis.zip", "url": "%[1]s/other", "direct_asset_url": "%[1]s/download/verbis.zip"},
+				{"name": "external.zip", "url": "%[2]s/external.zip"}
+			]}}`, ts.URL, external)
+		case "/download/verbis.zip":
+			_, _ = w.Write([]byte("archive"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	ts = httptest.NewServer(mux)
+	return ts
+}
+
+func TestGitlabSource(t *testing.T) {
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("PRIVATE-TOKEN"), "Token should not be sent to other hosts")
+		_, _ = w.Write([]byte("external"))
+	}))
+	defer external.Close()
+
+	ts := testGitlab(external.URL)
+	defer ts.Close()
+
+	tt := map[string]struct {
+		source  GitlabSource
+		archive string
+		want    interface{}
+	}{
+		"Success": {
+			GitlabSource{BaseURL: ts.URL + "/", Project: "group/verbis", Token: "secret"},
+			"verbis.zip",
+			"archive",
+		},
+		"External": {
+			GitlabSource{BaseURL: ts.URL, Project: "group/verbis", Token: "secret"},
+			"external.zip",
+			"external",
+		},
+		"Not Found": {
+			GitlabSource{BaseURL: ts.URL, Project: "group/verbis", Token: "secret"},
+			"wrong.zip",
+			ErrNoRelease.Error(),
+		},
+		"Unauthorised": {
+			GitlabSource{BaseURL: ts.URL, Project: "group/verbis"},
+			"verbis.zip",
+			"401",
+		},
+		"No Project": {
+			GitlabSource{BaseURL: ts.URL},
+			"verbis.zip",
+			ErrGitlabProject.Error(),
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			latest, err := test.source.LatestVersion(context.Background())
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.Equal(t, "v0.0.2", latest)
+
+			releases, err := test.source.Releases(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"v0.0.2", "v0.0.1"}, releases)
+
+			rc, err := test.source.Open(context.Background(), latest, test.archive)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			defer rc.Close()
+			got, err := ioutil.ReadAll(rc)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, string(got))
+		})
+	}
+}
+
+func TestGitlabSource_NoReleases(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer ts.Close()
+
+	_, err := (&GitlabSource{BaseURL: ts.URL, Project: "verbis"}).LatestVersion(context.Background())
+	assert.Contains(t, err.Error(), "no releases found for verbis")
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"github.com/hashicorp/go-version"
+	"strings"
+	"time"
+)
+
+// historyTable is the name of the table used to persist
+// the migrations that have been applied by the Updater.
+const historyTable = "updater_migrations"
+
+// historyRecord represents a singular row within the
+// history table.
+type historyRecord struct {
+	Version  string
+	Stage    Stage
+	Duration time.Duration
+	Success  bool
+	// Dirty is set when a migration failed and could not
+	// be rolled back, leaving the database in an
+	// unknown state.
+	Dirty bool
+	// Checksum is the SHA-256 hash of the SQL that was
+	// applied, empty if the migration had no SQL.
+	Checksum string
+}
+
+// history contains the records that have been obtained
+// from the history table.
+type history []historyRecord
+
+// createHistory creates the history table if it does
+// not already exist. This is run outside of the
+// migration transaction as some drivers
+// implicitly commit DDL statements.
+func (u *Updater) createHistory(ctx context.Context) error {
+	_, err := u.opts.DB.ExecContext(ctx, u.dialect().CreateHistory(historyTable))
+	return err
+}
+
+// history creates the history table if it does not
+// exist and retrieves all of the records stored
+// within it.
+func (u *Updater) history(ctx context.Context) (history, error) {
+	err := u.createHistory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return u.queryHistory(ctx)
+}
+
+// readHistory retrieves the records of the history table
+// without creating it, so nothing is written to the
+// database. A missing table is treated as an
+// empty history.
+func (u *Updater) readHistory(ctx context.Context) (history, error) {
+	h, err := u.queryHistory(ctx)
+	if err != nil && isMissingTable(err) {
+		return nil, nil
+	}
+	return h, err
+}
+
+// isMissingTable determines if the error was returned by
+// the database as the table queried does not exist,
+// using the messages of SQLite, Postgres and
+// MySQL.
+func isMissingTable(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "no such table") ||
+		strings.Contains(msg, "does not exist") ||
+		strings.Contains(msg, "doesn't exist")
+}
+
+// queryHistory retrieves all of the records stored within
+// the history table.
+func (u *Updater) queryHistory(ctx context.Context) (history, error) {
+	rows, err := u.opts.DB.QueryContext(ctx, "SELECT version, success, dirty, checksum FROM "+historyTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var h history
+	for rows.Next() {
+		var r historyRecord
+		err := rows.Scan(&r.Version, &r.Success, &r.Dirty, &r.Checksum)
+		if err != nil {
+			return nil, err
+		}
+		h = append(h, r)
+	}
+
+	return h, rows.Err()
+}
+
+// newRecord returns a history record for the migration.
+func (u *Updater) newRecord(m *Migration, duration time.Duration, success bool) historyRecord {
+	// Errors reading the SQL are returned when the
+	// migration is processed.
+	sum, _ := m.checksum()
+	return historyRecord{
+		Version:  m.Version,
+		Stage:    u.registry().Stage(m),
+		Duration: duration,
+		Success:  success,
+		Checksum: sum,
+	}
+}
+
+// record inserts a row into the history table using
+// the transaction or database passed.
+func (u *Updater) record(ctx context.Context, ex execer, r historyRecord) error {
+	query := bind(u.dialect(), "INSERT INTO "+historyTable+" (version, stage, applied_at, duration, success, dirty, checksum) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	args := []interface{}{r.Version, string(r.Stage), time.Now().UTC(), r.Duration.Milliseconds(), r.Success, r.Dirty, r.Checksum}
+	_, err := ex.ExecContext(ctx, query, args...)
+	return err
+}
+
+// forget removes all rows from the history table for
+// the given migration using the transaction or
+// database passed.
+func (u *Updater) forget(ctx context.Context, ex execer, m *Migration) error {
+	_, err := ex.ExecContext(ctx, bind(u.dialect(), "DELETE FROM "+historyTable+" WHERE version = ?"), m.Version)
+	return err
+}
+
+// dirty returns the most recent record that has been
+// marked as dirty, nil is returned if the database
+// is not in a dirty state.
+func (h history) dirty() *historyRecord {
+	for i := len(h) - 1; i >= 0; i-- {
+		if h[i].Dirty {
+			return &h[i]
+		}
+	}
+	return nil
+}
+
+// start returns the current version, or the version
+// passed if nothing has been applied.
+func (h history) start(from *version.Version) *version.Version {
+	if current := h.current(); current != nil {
+		return current
+	}
+	return from
+}
+
+// current returns the highest version that has been
+// successfully applied. Nil will be returned if
+// there are no successful records.
+func (h history) current() *version.Version {
+	var current *version.Version
+	for _, r := range h {
+		if !r.Success {
+			continue
+		}
+		ver, err := version.NewVersion(r.Version)
+		if err != nil {
+			continue
+		}
+		if current == nil || ver.GreaterThan(current) {
+			current = ver
+		}
+	}
+	return current
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUpdater_History(t *testing.T) {
+	tt := map[string]struct {
+		mock func(m sqlmock.Sqlmock)
+		want interface{}
+	}{
+		"Success": {
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.1", "v0.0.2")
+			},
+			history{{Version: "v0.0.1", Success: true}, {Version: "v0.0.2", Success: true}},
+		},
+		"Create Error": {
+			func(m sqlmock.Sqlmock) {
+				m.ExpectExec("CREATE TABLE IF NOT EXISTS " + historyTable).
+					WillReturnError(fmt.Errorf("create error"))
+			},
+			"create error",
+		},
+		"Query Error": {
+			func(m sqlmock.Sqlmock) {
+				m.ExpectExec("CREATE TABLE IF NOT EXISTS " + historyTable).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectQuery("SELECT version, success, dirty, checksum FROM " + historyTable).
+					WillReturnError(fmt.Errorf("query error"))
+			},
+			"query error",
+		},
+		"Scan Error": {
+			func(m sqlmock.Sqlmock) {
+				m.ExpectExec("CREATE TABLE IF NOT EXISTS " + historyTable).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectQuery("SELECT version, success, dirty, checksum FROM " + historyTable).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "success", "dirty", "checksum"}).AddRow("v0.0.1", "wrong", false, ""))
+			},
+			"Scan error",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			test.mock(mock)
+
+			u := Updater{opts: Options{DB: db, hasDB: true}}
+			got, err := u.history(context.Background())
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestUpdater_ReadHistory(t *testing.T) {
+	tt := map[string]struct {
+		err  error
+		want interface{}
+	}{
+		"SQLite": {
+			fmt.Errorf("no such table: " + historyTable),
+			nil,
+		},
+		"Postgres": {
+			fmt.Errorf(`pq: relation "` + historyTable + `" does not exist`),
+			nil,
+		},
+		"MySQL": {
+			fmt.Errorf("Error 1146: Table 'db." + historyTable + "' doesn't exist"),
+			nil,
+		},
+		"Error": {
+			fmt.Errorf("query error"),
+			"query error",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			mock.ExpectQuery("SELECT version, success, dirty, checksum FROM " + historyTable).
+				WillReturnError(test.err)
+
+			u := Updater{opts: Options{DB: db, hasDB: true}}
+			got, err := u.readHistory(context.Background())
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.Nil(t, test.want)
+			assert.Empty(t, got)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestHistory_Current(t *testing.T) {
+	tt := map[string]struct {
+		input history
+		want  interface{}
+	}{
+		"Empty": {
+			nil,
+			nil,
+		},
+		"Highest": {
+			history{{Version: "v0.0.2", Success: true}, {Version: "v0.1.0", Success: true}, {Version: "v0.0.3", Success: true}},
+			"0.1.0",
+		},
+		"Failed": {
+			history{{Version: "v0.0.2", Success: true}, {Version: "v0.0.3", Success: false}},
+			"0.0.2",
+		},
+		"Malformed": {
+			history{{Version: "wrong", Success: true}},
+			nil,
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			got := test.input.current()
+			if test.want == nil {
+				assert.Nil(t, got)
+				return
+			}
+			assert.Equal(t, test.want, got.String())
+		})
+	}
+}
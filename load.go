@@ -0,0 +1,189 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	// upSuffix is the file suffix of a migration going up.
+	upSuffix = ".up.sql"
+	// downSuffix is the file suffix of a migration going
+	// down.
+	downSuffix = ".down.sql"
+)
+
+var (
+	// ErrMigrationFile is returned by LoadMigrations when
+	// a migration file name or pair is invalid.
+	ErrMigrationFile = errors.New("invalid migration file")
+)
+
+// LoadMigrations reads the SQL migration files within the
+// directory of the file system and adds them to the
+// default registry, see Registry.Load.
+func LoadMigrations(fsys fs.FS, dir string, merge ...*Migration) error {
+	return defaultRegistry.Load(fsys, dir, merge...)
+}
+
+// Load reads the SQL migration files within the
+// directory of the file system and adds them to the
+// registry. Files are named by version and stage
+// such as "v0.0.2_minor.up.sql", with an optional
+// "v0.0.2_minor.down.sql" to reverse it. Files
+// that do not end in .sql are ignored. The
+// stage may be omitted if InferStage is
+// set on the registry.
+//
+// Migrations passed are merged with the files of the
+// same version, so functions, callbacks and the
+// transaction mode can be defined in Go.
+// Nothing is added if any of the files
+// are invalid.
+func (r *Registry) Load(fsys fs.FS, dir string, merge ...*Migration) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	var (
+		loaded = make(map[string]*Migration)
+		downs  = make(map[string]string)
+	)
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+
+		ver, stage, up, err := parseMigrationFile(name, r.InferStage)
+		if err != nil {
+			return err
+		}
+
+		buf, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return err
+		}
+
+		key := ver.String()
+		m, ok := loaded[key]
+		if !ok {
+			m = &Migration{Version: ver.Original(), Stage: stage}
+			loaded[key] = m
+		}
+
+		if m.Stage != stage {
+			return fmt.Errorf("%w: stage mismatch for version %s", ErrMigrationFile, m.Version)
+		}
+
+		if up {
+			if m.SQL != nil {
+				return fmt.Errorf("%w: duplicate up migration for version %s", ErrMigrationFile, m.Version)
+			}
+			m.SQL = bytes.NewReader(buf)
+			continue
+		}
+
+		if m.SQLDown != nil {
+			return fmt.Errorf("%w: duplicate down migration for version %s", ErrMigrationFile, m.Version)
+		}
+		m.SQLDown = bytes.NewReader(buf)
+		downs[key] = name
+	}
+
+	for key, name := range downs {
+		if loaded[key].SQL == nil {
+			return fmt.Errorf("%w: %s has no up migration", ErrMigrationFile, name)
+		}
+	}
+
+	for _, mm := range merge {
+		ver, err := version.NewVersion(mm.Version)
+		if err != nil {
+			return err
+		}
+		m, ok := loaded[ver.String()]
+		if !ok {
+			return fmt.Errorf("%w: no migration file for version %s", ErrMigrationFile, mm.Version)
+		}
+		m.Up = mm.Up
+		m.Down = mm.Down
+		m.CallBackUp = mm.CallBackUp
+		m.CallBackDown = mm.CallBackDown
+		m.Transaction = mm.Transaction
+	}
+
+	registry := make(MigrationRegistry, 0, len(loaded))
+	for _, m := range loaded {
+		if r.contains(m.toSemVer()) {
+			return fmt.Errorf("%w: version %s has already been added", ErrMigrationFile, m.Version)
+		}
+		if m.CallBackUp != nil && m.CallBackDown == nil || m.CallBackUp == nil && m.CallBackDown != nil {
+			return ErrCallBackMismatch
+		}
+		registry = append(registry, m)
+	}
+	sort.Sort(registry)
+
+	for _, m := range registry {
+		err := r.Add(m)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseMigrationFile returns the version and stage of the
+// migration file name, and whether it is going up.
+// The stage may be omitted from the name if it is
+// inferred, such as "v0.0.2.up.sql".
+func parseMigrationFile(name string, infer bool) (*version.Version, Stage, bool, error) {
+	var (
+		base string
+		up   bool
+	)
+
+	switch {
+	case strings.HasSuffix(name, upSuffix):
+		base, up = strings.TrimSuffix(name, upSuffix), true
+	case strings.HasSuffix(name, downSuffix):
+		base = strings.TrimSuffix(name, downSuffix)
+	default:
+		return nil, "", false, fmt.Errorf("%w: %s must end in %s or %s", ErrMigrationFile, name, upSuffix, downSuffix)
+	}
+
+	parts := strings.SplitN(base, "_", 2)
+	if len(parts) != 2 && !infer {
+		return nil, "", false, fmt.Errorf("%w: %s must be named version_stage", ErrMigrationFile, name)
+	}
+
+	ver, err := parseVersion(parts[0])
+	if err != nil {
+		return nil, "", false, fmt.Errorf("%w: %s: %s", ErrMigrationFile, name, err.Error())
+	}
+
+	if len(parts) == 1 {
+		return ver, "", up, nil
+	}
+
+	stage := Stage(strings.ToLower(parts[1]))
+	if !validStage(stage) {
+		return nil, "", false, fmt.Errorf("%w: %s has an unknown stage", ErrMigrationFile, name)
+	}
+
+	return ver, stage, up, nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRegistry_Load(t *testing.T) {
+	callback := func() error { return nil }
+
+	tt := map[string]struct {
+		files fstest.MapFS
+		merge []*Migration
+		want  interface{}
+	}{
+		"Success": {
+			fstest.MapFS{
+				"migrations/v0.0.2_minor.up.sql":   {Data: []byte(v002)},
+				"migrations/v0.0.2_minor.down.sql": {Data: []byte(v002Down)},
+				"migrations/v0.0.1_patch.up.sql":   {Data: []byte(v001)},
+				"migrations/README.md":             {Data: []byte("readme")},
+			},
+			nil,
+			[]string{"v0.0.1 patch " + v001 + " ", "v0.0.2 minor " + v002 + " " + v002Down},
+		},
+		"Merge": {
+			fstest.MapFS{
+				"migrations/v0.0.1_patch.up.sql": {Data: []byte(v001)},
+			},
+			[]*Migration{{Version: "0.0.1", CallBackUp: callback, CallBackDown: callback, Transaction: TxNone}},
+			[]string{"v0.0.1 patch " + v001 + " "},
+		},
+		"Merge Not Found": {
+			fstest.MapFS{
+				"migrations/v0.0.1_patch.up.sql": {Data: []byte(v001)},
+			},
+			[]*Migration{{Version: "v0.0.2", CallBackUp: callback, CallBackDown: callback}},
+			"no migration file for version v0.0.2",
+		},
+		"Merge Mismatch": {
+			fstest.MapFS{
+				"migrations/v0.0.1_patch.up.sql": {Data: []byte(v001)},
+			},
+			[]*Migration{{Version: "v0.0.1", CallBackUp: callback}},
+			ErrCallBackMismatch.Error(),
+		},
+		"No Directory": {
+			fstest.MapFS{},
+			nil,
+			"file does not exist",
+		},
+		"Bad Suffix": {
+			fstest.MapFS{
+				"migrations/v0.0.1_patch.sql": {Data: []byte(v001)},
+			},
+			nil,
+			"must end in .up.sql or .down.sql",
+		},
+		"No Stage": {
+			fstest.MapFS{
+				"migrations/v0.0.1.up.sql": {Data: []byte(v001)},
+			},
+			nil,
+			"must be named version_stage",
+		},
+		"Bad Version": {
+			fstest.MapFS{
+				"migrations/wrong_patch.up.sql": {Data: []byte(v001)},
+			},
+			nil,
+			ErrInvalidVersion.Error(),
+		},
+		"Bad Stage": {
+			fstest.MapFS{
+				"migrations/v0.0.1_wrong.up.sql": {Data: []byte(v001)},
+			},
+			nil,
+			"unknown stage",
+		},
+		"Stage Mismatch": {
+			fstest.MapFS{
+				"migrations/v0.0.2_minor.up.sql":   {Data: []byte(v002)},
+				"migrations/v0.0.2_patch.down.sql": {Data: []byte(v002Down)},
+			},
+			nil,
+			"stage mismatch for version v0.0.2",
+		},
+		"No Up": {
+			fstest.MapFS{
+				"migrations/v0.0.2_minor.down.sql": {Data: []byte(v002Down)},
+			},
+			nil,
+			"v0.0.2_minor.down.sql has no up migration",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			r := NewRegistry()
+
+			err := r.Load(test.files, "migrations", test.merge...)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				assert.Empty(t, r.All())
+				return
+			}
+
+			migrations := r.All()
+
+			var got []string
+			for _, m := range migrations {
+				up, err := readSQL(m.SQL)
+				assert.NoError(t, err)
+				down, err := readSQL(m.SQLDown)
+				assert.NoError(t, err)
+				got = append(got, m.Version+" "+string(m.Stage)+" "+up+" "+down)
+			}
+			assert.Equal(t, test.want, got)
+
+			if test.merge != nil {
+				assert.True(t, migrations[0].hasCallBack())
+				assert.Equal(t, test.merge[0].Transaction, migrations[0].Transaction)
+			}
+		})
+	}
+}
+
+func TestLoadMigrations_Duplicate(t *testing.T) {
+	defer func() {
+		defaultRegistry = NewRegistry()
+	}()
+
+	files := fstest.MapFS{
+		"migrations/v0.0.1_patch.up.sql": {Data: []byte(v001)},
+	}
+
+	err := LoadMigrations(files, "migrations")
+	assert.NoError(t, err)
+
+	err = LoadMigrations(files, "migrations")
+	assert.ErrorIs(t, err, ErrMigrationFile)
+	assert.Len(t, AllMigrations(), 1)
+
+	buf, err := ioutil.ReadAll(AllMigrations()[0].SQL)
+	assert.NoError(t, err)
+	assert.Equal(t, v001, string(buf))
+}
+
+func TestRegistry_LoadInferStage(t *testing.T) {
+	files := fstest.MapFS{
+		"migrations/v0.1.0.up.sql":       {Data: []byte(v002)},
+		"migrations/v0.1.0.down.sql":     {Data: []byte(v002Down)},
+		"migrations/v0.0.1_patch.up.sql": {Data: []byte(v001)},
+	}
+
+	err := NewRegistry().Load(files, "migrations")
+	assert.Contains(t, err.Error(), "must be named version_stage")
+
+	r := &Registry{InferStage: true}
+	err = r.Load(files, "migrations")
+	assert.NoError(t, err)
+
+	all := r.All()
+	assert.Len(t, all, 2)
+	assert.EqualValues(t, Patch, r.Stage(all[0]))
+	assert.EqualValues(t, Minor, r.Stage(all[1]))
+}
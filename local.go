@@ -0,0 +1,207 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// LocalManifest is the name of the optional file next to
+// the archives of a LocalSource, that sets the version
+// of the archives rather than their file names,
+// such as {"version": "v0.0.2"}.
+const LocalManifest = "release.json"
+
+// LocalSource is a Source that reads releases from the
+// local file system, for installs without network
+// access. The version of an archive is taken from
+// the LocalManifest if there is one, otherwise
+// from its file name such as
+// "my-repo_v0.0.2_linux_amd64.zip".
+type LocalSource struct {
+	// The path of a directory of release archives, or of
+	// a single archive.
+	Path string
+}
+
+// localArchive is an archive found by the LocalSource.
+type localArchive struct {
+	path    string
+	version *version.Version
+}
+
+// archives returns the archives at the path, sorted by
+// version, newest first.
+func (l *LocalSource) archives() ([]localArchive, error) {
+	info, err := os.Stat(l.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, paths := l.Path, []string{l.Path}
+	if info.IsDir() {
+		entries, err := ioutil.ReadDir(l.Path)
+		if err != nil {
+			return nil, err
+		}
+		paths = nil
+		for _, entry := range entries {
+			if entry.IsDir() || entry.Name() == LocalManifest {
+				continue
+			}
+			paths = append(paths, filepath.Join(l.Path, entry.Name()))
+		}
+	} else {
+		dir = filepath.Dir(l.Path)
+	}
+
+	manifest, err := readLocalManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var archives []localArchive
+	for _, path := range paths {
+		ver := manifest
+		if ver == nil {
+			info, ok := ParseArchiveName(filepath.Base(path))
+			if !ok {
+				continue
+			}
+			ver = info.Version
+		}
+		archives = append(archives, localArchive{path: path, version: ver})
+	}
+
+	sort.SliceStable(archives, func(i, j int) bool {
+		return archives[i].version.GreaterThan(archives[j].version)
+	})
+
+	return archives, nil
+}
+
+// readLocalManifest returns the version within the
+// LocalManifest of the directory, nil is returned
+// if there is none.
+func readLocalManifest(dir string) (*version.Version, error) {
+	buf, err := ioutil.ReadFile(filepath.Join(dir, LocalManifest))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var manifest struct {
+		Version string `json:"version"`
+	}
+	err = json.Unmarshal(buf, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %s", LocalManifest, err.Error())
+	}
+
+	return version.NewVersion(manifest.Version)
+}
+
+// Releases returns the versions of the archives, newest
+// first.
+func (l *LocalSource) Releases(ctx context.Context) ([]string, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	archives, err := l.archives()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		releases = make([]string, 0, len(archives))
+		seen     = make(map[string]bool)
+	)
+	for _, a := range archives {
+		if seen[a.version.String()] {
+			continue
+		}
+		seen[a.version.String()] = true
+		releases = append(releases, a.version.Original())
+	}
+
+	return releases, nil
+}
+
+// LatestVersion returns the version of the newest
+// archive.
+func (l *LocalSource) LatestVersion(ctx context.Context) (string, error) {
+	releases, err := l.Releases(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if len(releases) == 0 {
+		return "", fmt.Errorf("%w: no archives found in %s", ErrNoRelease, l.Path)
+	}
+
+	return releases[0], nil
+}
+
+// URL returns the path of the archive of the release.
+// If the Path is a single archive, the archive name
+// is ignored.
+func (l *LocalSource) URL(v, archive string) (string, error) {
+	a, err := l.find(v, archive)
+	if err != nil {
+		return "", err
+	}
+	return a.path, nil
+}
+
+// Open opens the archive of the release. If the Path is a
+// single archive, the archive name is ignored.
+func (l *LocalSource) Open(ctx context.Context, v, archive string) (io.ReadCloser, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	a, err := l.find(v, archive)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(a.path)
+}
+
+// find returns the archive of the version with the name
+// passed.
+func (l *LocalSource) find(v, archive string) (localArchive, error) {
+	ver, err := version.NewVersion(v)
+	if err != nil {
+		return localArchive{}, err
+	}
+
+	archives, err := l.archives()
+	if err != nil {
+		return localArchive{}, err
+	}
+
+	single := len(archives) == 1 && archives[0].path == l.Path
+	for _, a := range archives {
+		if !a.version.Equal(ver) {
+			continue
+		}
+		if single || filepath.Base(a.path) == archive {
+			return a, nil
+		}
+	}
+
+	return localArchive{}, fmt.Errorf("%w: %s for version %s in %s", ErrNoRelease, archive, v, l.Path)
+}
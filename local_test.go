@@ -0,0 +1,193 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"github.com/hashicorp/go-version"
+	"github.com/mouuff/go-rocket-update/pkg/updater"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testLocalDir writes the files passed to a temporary
+// directory and returns its path.
+func testLocalDir(t *testing.T, files map[string][]byte) string {
+	dir := t.TempDir()
+	for name, buf := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), buf, os.ModePerm))
+	}
+	return dir
+}
+
+func TestLocalSource_Releases(t *testing.T) {
+	tt := map[string]struct {
+		files  map[string][]byte
+		single string
+		want   interface{}
+	}{
+		"Directory": {
+			map[string][]byte{
+				"verbis_v0.0.1_linux_amd64.zip":  []byte("1"),
+				"verbis_v0.0.10_linux_amd64.zip": []byte("10"),
+				"verbis_v0.0.2_linux_amd64.zip":  []byte("2"),
+				"verbis_v0.0.2_darwin_amd64.zip": []byte("2"),
+				"README.md":                      []byte("readme"),
+			},
+			"",
+			[]string{"v0.0.10", "v0.0.2", "v0.0.1"},
+		},
+		"Dashes": {
+			map[string][]byte{
+				"app-v1.2.3-linux-amd64.tar.gz":      []byte("3"),
+				"app-v1.2.4-rc.1-linux-amd64.tar.gz": []byte("4"),
+				"app-v1.2.2-darwin-arm64.tar.gz":     []byte("2"),
+			},
+			"",
+			[]string{"v1.2.4-rc.1", "v1.2.3", "v1.2.2"},
+		},
+		"Manifest": {
+			map[string][]byte{
+				"verbis_linux_amd64.zip": []byte("1"),
+				LocalManifest:            []byte(`{"version": "v1.2.0"}`),
+			},
+			"",
+			[]string{"v1.2.0"},
+		},
+		"Bad Manifest": {
+			map[string][]byte{
+				"verbis_linux_amd64.zip": []byte("1"),
+				LocalManifest:            []byte(`wrong`),
+			},
+			"",
+			"error reading " + LocalManifest,
+		},
+		"Single": {
+			map[string][]byte{
+				"verbis_v0.0.2_linux_amd64.zip": []byte("2"),
+				"verbis_v0.0.3_linux_amd64.zip": []byte("3"),
+			},
+			"verbis_v0.0.2_linux_amd64.zip",
+			[]string{"v0.0.2"},
+		},
+		"Empty": {
+			map[string][]byte{},
+			"",
+			ErrNoRelease.Error(),
+		},
+		"Not Found": {
+			map[string][]byte{},
+			"wrong.zip",
+			"no such file",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			l := &LocalSource{Path: filepath.Join(testLocalDir(t, test.files), test.single)}
+
+			latest, err := l.LatestVersion(context.Background())
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+
+			got, err := l.Releases(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, got)
+			assert.Equal(t, got[0], latest)
+		})
+	}
+}
+
+func TestLocalSource_Open(t *testing.T) {
+	dir := testLocalDir(t, map[string][]byte{
+		"verbis_v0.0.1_linux_amd64.zip": []byte("1"),
+		"verbis_v0.0.2_linux_amd64.zip": []byte("2"),
+	})
+
+	tt := map[string]struct {
+		path    string
+		version string
+		archive string
+		want    interface{}
+	}{
+		"Directory": {
+			dir,
+			"v0.0.1",
+			"verbis_v0.0.1_linux_amd64.zip",
+			"1",
+		},
+		"Wrong Version": {
+			dir,
+			"v0.0.2",
+			"verbis_v0.0.1_linux_amd64.zip",
+			ErrNoRelease.Error(),
+		},
+		"Wrong Archive": {
+			dir,
+			"v0.0.2",
+			"verbis_v0.0.2_darwin_amd64.zip",
+			ErrNoRelease.Error(),
+		},
+		"Single": {
+			filepath.Join(dir, "verbis_v0.0.2_linux_amd64.zip"),
+			"0.0.2",
+			"verbis.zip",
+			"2",
+		},
+		"Bad Version": {
+			dir,
+			"wrong",
+			"verbis.zip",
+			"Malformed version",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			l := &LocalSource{Path: test.path}
+			rc, err := l.Open(context.Background(), test.version, test.archive)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			defer rc.Close()
+			got, err := ioutil.ReadAll(rc)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, string(got))
+		})
+	}
+}
+
+func TestLocalSource_Update(t *testing.T) {
+	dir := testLocalDir(t, map[string][]byte{
+		"verbis_v0.0.2.zip": testArchive(t, map[string]string{"verbis": "new"}),
+	})
+
+	exec := filepath.Join(t.TempDir(), "verbis")
+	assert.NoError(t, ioutil.WriteFile(exec, []byte("old"), os.ModePerm))
+
+	u := Updater{
+		opts:    Options{Version: "v0.0.1", Source: &LocalSource{Path: dir}, Registry: NewRegistry()},
+		pkg:     &updater.Updater{OverrideExecutable: exec},
+		version: version.Must(version.NewVersion("v0.0.1")),
+	}
+
+	plan, err := u.Plan("verbis_v0.0.2.zip")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "verbis_v0.0.2.zip"), plan.URL)
+
+	status, err := u.Update("verbis_v0.0.2.zip")
+	assert.NoError(t, err)
+	assert.Equal(t, Status(Updated), status)
+
+	got, err := ioutil.ReadFile(exec)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(got))
+}
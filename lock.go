@@ -0,0 +1,256 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLockTimeout is the amount of time to wait for
+	// the migration lock when no LockTimeout is set in
+	// the options.
+	DefaultLockTimeout = 15 * time.Second
+	// lockTable is the name of the table used as a lock by
+	// dialects that have no native locking.
+	lockTable = "updater_lock"
+	// lockInterval is the interval between attempts to
+	// acquire the lock when polling.
+	lockInterval = 100 * time.Millisecond
+	// lockExpiry is the age at which a row in the lock
+	// table is considered stale, left by an instance
+	// that crashed whilst migrating.
+	lockExpiry = time.Hour
+)
+
+var (
+	// ErrLocked is returned when the migration lock could
+	// not be acquired within the timeout, as another
+	// instance is migrating.
+	ErrLocked = errors.New("timed out acquiring migration lock")
+	// ErrLockLost is returned when the migration lock was
+	// no longer held by the instance releasing it.
+	ErrLockLost = errors.New("migration lock is no longer held")
+	// lockKey is the key used for advisory locks.
+	lockKey = int64(crc32.ChecksumIEEE([]byte(historyTable)))
+)
+
+// tableLocker is implemented by dialects whose lock is
+// held by a row in the lock table rather than by the
+// session, the connection used to acquire the lock
+// is then released whilst migrating.
+type tableLocker interface {
+	tableLock()
+}
+
+// withLock acquires the migration lock of the dialect on
+// a dedicated connection and runs the function passed
+// before releasing it. Locked is returned if the
+// lock could not be obtained in time. The lock is
+// released even if the context has been
+// cancelled.
+//
+// Session locks hold the connection whilst migrating,
+// so the pool of the database must allow at least
+// two open connections. The SQLite lock row does
+// not, so a single connection is sufficient.
+func (u *Updater) withLock(ctx context.Context, fn func() (Status, error)) (Status, error) {
+	if !u.opts.hasDB {
+		return fn()
+	}
+
+	conn, err := u.opts.DB.Conn(ctx)
+	if err != nil {
+		return DatabaseError, err
+	}
+	defer conn.Close()
+
+	timeout := u.opts.LockTimeout
+	if timeout == 0 {
+		timeout = DefaultLockTimeout
+	}
+
+	owner, err := lockOwner()
+	if err != nil {
+		return Unknown, err
+	}
+
+	err = u.dialect().Lock(ctx, conn, owner, timeout)
+	if errors.Is(err, ErrLocked) {
+		return Locked, err
+	} else if err != nil {
+		return DatabaseError, err
+	}
+
+	if _, ok := u.dialect().(tableLocker); ok {
+		conn.Close()
+	}
+
+	status, err := fn()
+
+	unlockErr := u.unlock(conn, owner)
+	if err != nil {
+		return status, err
+	}
+	if unlockErr != nil {
+		return DatabaseError, unlockErr
+	}
+
+	return status, nil
+}
+
+// unlock releases the migration lock held by withLock.
+// A new connection is used for dialects that locked
+// with a row, as the original has been released.
+func (u *Updater) unlock(conn *sql.Conn, owner string) error {
+	ctx := context.Background()
+	if _, ok := u.dialect().(tableLocker); ok {
+		var err error
+		conn, err = u.opts.DB.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+	}
+	return u.dialect().Unlock(ctx, conn, owner)
+}
+
+// lockOwner returns a random token identifying the
+// holder of the migration lock.
+func lockOwner() (string, error) {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// poll calls try until it reports the lock has been
+// acquired, or the timeout has elapsed in which
+// case ErrLocked is returned.
+func poll(ctx context.Context, timeout time.Duration, try func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := try()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrLocked
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockInterval):
+		}
+	}
+}
+
+// Lock for the generic dialect is a no-op as there is no
+// portable way of locking.
+func (generic) Lock(context.Context, *sql.Conn, string, time.Duration) error {
+	return nil
+}
+
+// Unlock for the generic dialect is a no-op.
+func (generic) Unlock(context.Context, *sql.Conn, string) error {
+	return nil
+}
+
+// Lock acquires a session level advisory lock, polling
+// pg_try_advisory_lock until the timeout.
+func (postgres) Lock(ctx context.Context, conn *sql.Conn, _ string, timeout time.Duration) error {
+	return poll(ctx, timeout, func() (bool, error) {
+		var ok bool
+		err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", lockKey).Scan(&ok)
+		return ok, err
+	})
+}
+
+// Unlock releases the advisory lock.
+func (postgres) Unlock(ctx context.Context, conn *sql.Conn, _ string) error {
+	_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey)
+	return err
+}
+
+// Lock acquires a named lock using GET_LOCK, which waits
+// for the timeout in seconds.
+func (mysql) Lock(ctx context.Context, conn *sql.Conn, _ string, timeout time.Duration) error {
+	var ok sql.NullInt64
+	err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", historyTable, int(math.Ceil(timeout.Seconds()))).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok.Valid {
+		return errors.New("error acquiring migration lock")
+	}
+	if ok.Int64 != 1 {
+		return ErrLocked
+	}
+	return nil
+}
+
+// Unlock releases the named lock.
+func (mysql) Unlock(ctx context.Context, conn *sql.Conn, _ string) error {
+	_, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", historyTable)
+	return err
+}
+
+// Lock inserts a row with the owner into the lock table,
+// as SQLite has no named locks. The insert is retried
+// until the timeout while another instance holds
+// the row. A row older than an hour is stale,
+// left by an instance that crashed, and is
+// removed.
+func (sqlite) Lock(ctx context.Context, conn *sql.Conn, owner string, timeout time.Duration) error {
+	_, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+lockTable+" (id INTEGER PRIMARY KEY, owner TEXT NOT NULL, locked_at TIMESTAMP NOT NULL)")
+	if err != nil {
+		return err
+	}
+	return poll(ctx, timeout, func() (bool, error) {
+		now := time.Now().UTC()
+		_, err := conn.ExecContext(ctx, "DELETE FROM "+lockTable+" WHERE id = 1 AND locked_at < ?", now.Add(-lockExpiry))
+		if err != nil {
+			return false, err
+		}
+		_, err = conn.ExecContext(ctx, "INSERT INTO "+lockTable+" (id, owner, locked_at) VALUES (1, ?, ?)", owner, now)
+		if err != nil && strings.Contains(strings.ToLower(err.Error()), "unique") {
+			return false, nil
+		}
+		return err == nil, err
+	})
+}
+
+func (sqlite) tableLock() {}
+
+// Unlock removes the row of the owner from the lock
+// table. ErrLockLost is returned if the row has
+// been removed as stale by another instance.
+func (sqlite) Unlock(ctx context.Context, conn *sql.Conn, owner string) error {
+	res, err := conn.ExecContext(ctx, "DELETE FROM "+lockTable+" WHERE id = 1 AND owner = ?", owner)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
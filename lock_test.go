@@ -0,0 +1,354 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// ownerArg matches the owner of the lock, storing the
+// first owner passed so later queries must match.
+type ownerArg struct {
+	owner string
+}
+
+func (a *ownerArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	if a.owner == "" {
+		a.owner = s
+	}
+	return a.owner == s
+}
+
+// expiryArg matches a time at the lock expiry before now.
+type expiryArg struct{}
+
+func (expiryArg) Match(v driver.Value) bool {
+	t, ok := v.(time.Time)
+	if !ok {
+		return false
+	}
+	age := time.Since(t)
+	return age > lockExpiry-time.Minute && age < lockExpiry+time.Minute
+}
+
+func TestDialect_Lock(t *testing.T) {
+	tt := map[string]struct {
+		dialect Dialect
+		mock    func(m sqlmock.Sqlmock)
+		want    interface{}
+	}{
+		"Postgres": {
+			Postgres,
+			func(m sqlmock.Sqlmock) {
+				m.ExpectQuery("SELECT pg_try_advisory_lock").
+					WithArgs(lockKey).
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(true))
+			},
+			nil,
+		},
+		"Postgres Retry": {
+			Postgres,
+			func(m sqlmock.Sqlmock) {
+				m.ExpectQuery("SELECT pg_try_advisory_lock").
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(false))
+				m.ExpectQuery("SELECT pg_try_advisory_lock").
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(true))
+			},
+			nil,
+		},
+		"Postgres Timeout": {
+			Postgres,
+			func(m sqlmock.Sqlmock) {
+				m.ExpectQuery("SELECT pg_try_advisory_lock").
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(false))
+				m.ExpectQuery("SELECT pg_try_advisory_lock").
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(false))
+			},
+			ErrLocked.Error(),
+		},
+		"MySQL": {
+			MySQL,
+			func(m sqlmock.Sqlmock) {
+				m.ExpectQuery("SELECT GET_LOCK").
+					WithArgs(historyTable, 1).
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+			},
+			nil,
+		},
+		"MySQL Timeout": {
+			MySQL,
+			func(m sqlmock.Sqlmock) {
+				m.ExpectQuery("SELECT GET_LOCK").
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(0))
+			},
+			ErrLocked.Error(),
+		},
+		"MySQL Error": {
+			MySQL,
+			func(m sqlmock.Sqlmock) {
+				m.ExpectQuery("SELECT GET_LOCK").
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(nil))
+			},
+			"error acquiring migration lock",
+		},
+		"SQLite": {
+			SQLite,
+			func(m sqlmock.Sqlmock) {
+				m.ExpectExec("CREATE TABLE IF NOT EXISTS " + lockTable).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectExec("DELETE FROM " + lockTable).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectExec("INSERT INTO " + lockTable).
+					WillReturnError(fmt.Errorf("UNIQUE constraint failed"))
+				m.ExpectExec("DELETE FROM " + lockTable).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectExec("INSERT INTO " + lockTable).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			nil,
+		},
+		"SQLite Stale": {
+			SQLite,
+			func(m sqlmock.Sqlmock) {
+				m.ExpectExec("CREATE TABLE IF NOT EXISTS " + lockTable).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectExec("DELETE FROM " + lockTable + " WHERE id = 1 AND locked_at <").
+					WithArgs(expiryArg{}).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.ExpectExec("INSERT INTO "+lockTable).
+					WithArgs("owner", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			nil,
+		},
+		"SQLite Error": {
+			SQLite,
+			func(m sqlmock.Sqlmock) {
+				m.ExpectExec("CREATE TABLE IF NOT EXISTS " + lockTable).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectExec("DELETE FROM " + lockTable).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectExec("INSERT INTO " + lockTable).
+					WillReturnError(fmt.Errorf("disk error"))
+			},
+			"disk error",
+		},
+		"SQLite Expire Error": {
+			SQLite,
+			func(m sqlmock.Sqlmock) {
+				m.ExpectExec("CREATE TABLE IF NOT EXISTS " + lockTable).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectExec("DELETE FROM " + lockTable).
+					WillReturnError(fmt.Errorf("disk error"))
+			},
+			"disk error",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			test.mock(mock)
+
+			conn, err := db.Conn(context.Background())
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			err = test.dialect.Lock(context.Background(), conn, "owner", time.Millisecond)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.Nil(t, test.want)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdater_WithLock(t *testing.T) {
+	tt := map[string]struct {
+		mock func(m sqlmock.Sqlmock)
+		fn   func() (Status, error)
+		want interface{}
+		code Status
+	}{
+		"Success": {
+			func(m sqlmock.Sqlmock) {
+				m.ExpectQuery("SELECT GET_LOCK").
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+				m.ExpectExec("SELECT RELEASE_LOCK").
+					WithArgs(historyTable).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			func() (Status, error) {
+				return Updated, nil
+			},
+			nil,
+			Updated,
+		},
+		"Locked": {
+			func(m sqlmock.Sqlmock) {
+				m.ExpectQuery("SELECT GET_LOCK").
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(0))
+			},
+			nil,
+			ErrLocked.Error(),
+			Locked,
+		},
+		"Lock Error": {
+			func(m sqlmock.Sqlmock) {
+				m.ExpectQuery("SELECT GET_LOCK").
+					WillReturnError(fmt.Errorf("lock error"))
+			},
+			nil,
+			"lock error",
+			DatabaseError,
+		},
+		"Function Error": {
+			func(m sqlmock.Sqlmock) {
+				m.ExpectQuery("SELECT GET_LOCK").
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+				m.ExpectExec("SELECT RELEASE_LOCK").
+					WillReturnError(fmt.Errorf("unlock error"))
+			},
+			func() (Status, error) {
+				return CallBackError, fmt.Errorf("callback error")
+			},
+			"callback error",
+			CallBackError,
+		},
+		"Unlock Error": {
+			func(m sqlmock.Sqlmock) {
+				m.ExpectQuery("SELECT GET_LOCK").
+					WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+				m.ExpectExec("SELECT RELEASE_LOCK").
+					WillReturnError(fmt.Errorf("unlock error"))
+			},
+			func() (Status, error) {
+				return Updated, nil
+			},
+			"unlock error",
+			DatabaseError,
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			test.mock(mock)
+
+			u := Updater{opts: Options{DB: db, hasDB: true, Dialect: MySQL, LockTimeout: time.Second}}
+			code, err := u.withLock(context.Background(), test.fn)
+			assert.Equal(t, test.code, code)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.Nil(t, test.want)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdater_WithLockSingleConnection(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS " + lockTable).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM " + lockTable).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	owner := &ownerArg{}
+	mock.ExpectExec("INSERT INTO "+lockTable).
+		WithArgs(owner, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(v001).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("DELETE FROM " + lockTable + " WHERE id = 1 AND owner").
+		WithArgs(owner).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	u := Updater{opts: Options{DB: db, hasDB: true, Dialect: SQLite, LockTimeout: time.Second}}
+	code, err := u.withLock(ctx, func() (Status, error) {
+		_, err := db.ExecContext(ctx, v001)
+		return Updated, err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, Status(Updated), code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDialect_Unlock(t *testing.T) {
+	tt := map[string]struct {
+		mock func(m sqlmock.Sqlmock)
+		want interface{}
+	}{
+		"Success": {
+			func(m sqlmock.Sqlmock) {
+				m.ExpectExec("DELETE FROM " + lockTable + " WHERE id = 1 AND owner").
+					WithArgs("owner").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			nil,
+		},
+		"Lost": {
+			func(m sqlmock.Sqlmock) {
+				m.ExpectExec("DELETE FROM " + lockTable).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			ErrLockLost.Error(),
+		},
+		"Error": {
+			func(m sqlmock.Sqlmock) {
+				m.ExpectExec("DELETE FROM " + lockTable).
+					WillReturnError(fmt.Errorf("disk error"))
+			},
+			"disk error",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			test.mock(mock)
+
+			conn, err := db.Conn(context.Background())
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			err = SQLite.Unlock(context.Background(), conn, "owner")
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.Nil(t, test.want)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,368 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Manifest lists the releases of an executable, it is
+// served as JSON by a static file host and read by
+// ManifestSource, for example:
+//
+//	{
+//		"releases": [
+//			{
+//				"version": "v0.0.2",
+//				"date": "2021-06-01T00:00:00Z",
+//				"notes": "Fixes the login page.",
+//				"mandatory": true,
+//				"assets": [
+//					{
+//						"name": "my-repo_v0.0.2_linux_amd64.zip",
+//						"os": "linux",
+//						"arch": "amd64",
+//						"url": "v0.0.2/my-repo_v0.0.2_linux_amd64.zip",
+//						"sha256": "9f86d08...",
+//						"size": 1024
+//					}
+//				]
+//			}
+//		]
+//	}
+type Manifest struct {
+	Releases []ManifestRelease `json:"releases"`
+}
+
+// ManifestRelease is a single release within the
+// Manifest.
+type ManifestRelease struct {
+	// The version of the release, such as "v0.0.2".
+	Version string `json:"version"`
+	// The time the release was published.
+	Date time.Time `json:"date,omitempty"`
+	// The release notes.
+	Notes string `json:"notes,omitempty"`
+	// Mandatory is true when the release should not be
+	// skipped, it is up to the caller to enforce it.
+	Mandatory bool `json:"mandatory,omitempty"`
+	// The archives of the release, one for each
+	// platform.
+	Assets []ManifestAsset `json:"assets"`
+}
+
+// ManifestAsset is the archive of a release for a single
+// platform.
+type ManifestAsset struct {
+	// The archive name passed to Update, such as
+	// "my-repo_v0.0.2_linux_amd64.zip".
+	Name string `json:"name"`
+	// The GOOS and GOARCH of the executable within the
+	// archive.
+	OS   string `json:"os,omitempty"`
+	Arch string `json:"arch,omitempty"`
+	// The URL of the archive, relative URLs are resolved
+	// against the URL of the manifest.
+	URL string `json:"url"`
+	// The hex encoded SHA-256 checksum of the archive,
+	// the archive is not verified if empty.
+	SHA256 string `json:"sha256,omitempty"`
+	// The size of the archive in bytes.
+	Size int64 `json:"size,omitempty"`
+}
+
+// ManifestSource is a Source that reads the releases of
+// the executable from a Manifest served over HTTP,
+// so updates can be hosted by any static file
+// host.
+type ManifestSource struct {
+	// The URL of the manifest JSON file.
+	URL string
+	// The key used to verify the signature of the
+	// manifest, which is read from the URL with
+	// ".sig" appended and contains the base64
+	// encoded ed25519 signature. The manifest
+	// is not verified if nil.
+	PublicKey ed25519.PublicKey
+	// Headers sent with every request to the host of the
+	// manifest, such as Authorization.
+	Header http.Header
+	// The client used for requests, http.DefaultClient is
+	// used if nil.
+	Client *http.Client
+}
+
+var (
+	// ErrChecksum is returned when the SHA-256 checksum of a
+	// downloaded archive does not match the manifest.
+	ErrChecksum = errors.New("checksum mismatch")
+	// ErrSignature is returned when the signature of the
+	// manifest could not be verified with the
+	// PublicKey.
+	ErrSignature = errors.New("invalid manifest signature")
+)
+
+// Asset returns the asset of the release for the platform
+// passed, such as runtime.GOOS and runtime.GOARCH. Nil
+// is returned if there is none.
+func (r *ManifestRelease) Asset(goos, goarch string) *ManifestAsset {
+	for i, a := range r.Assets {
+		if a.OS == goos && a.Arch == goarch {
+			return &r.Assets[i]
+		}
+	}
+	return nil
+}
+
+// named returns the asset of the release with the name
+// passed. Assets of other platforms may share the
+// name, so the asset for the platform passed is
+// preferred. Nil is returned if there is none.
+func (r *ManifestRelease) named(name, goos, goarch string) *ManifestAsset {
+	var found *ManifestAsset
+	for i, a := range r.Assets {
+		if a.Name != name {
+			continue
+		}
+		if a.OS == goos && a.Arch == goarch {
+			return &r.Assets[i]
+		}
+		if found == nil {
+			found = &r.Assets[i]
+		}
+	}
+	return found
+}
+
+// Manifest retrieves the manifest with the releases sorted
+// by version, newest first. If a PublicKey is set, an
+// error wrapping ErrSignature is returned if the
+// signature of the manifest is invalid.
+func (m *ManifestSource) Manifest(ctx context.Context) (*Manifest, error) {
+	buf, err := m.get(ctx, m.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.PublicKey != nil {
+		err = m.verify(ctx, buf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var manifest Manifest
+	err = json.Unmarshal(buf, &manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make(map[string]*version.Version)
+	for _, r := range manifest.Releases {
+		ver, err := version.NewVersion(r.Version)
+		if err != nil {
+			return nil, fmt.Errorf("error reading manifest %s: %s", m.URL, err.Error())
+		}
+		versions[r.Version] = ver
+	}
+
+	sort.SliceStable(manifest.Releases, func(i, j int) bool {
+		return versions[manifest.Releases[i].Version].GreaterThan(versions[manifest.Releases[j].Version])
+	})
+
+	return &manifest, nil
+}
+
+// get retrieves the body of the URL passed.
+func (m *ManifestSource) get(ctx context.Context, url string) ([]byte, error) {
+	resp, err := sourceGet(ctx, m.Client, url, m.Header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// verify retrieves the signature of the manifest and
+// verifies it with the PublicKey.
+func (m *ManifestSource) verify(ctx context.Context, manifest []byte) error {
+	if len(m.PublicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: public key must be %d bytes", ErrSignature, ed25519.PublicKeySize)
+	}
+
+	buf, err := m.get(ctx, m.URL+".sig")
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrSignature, err.Error())
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(buf)))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrSignature, err.Error())
+	}
+
+	if !ed25519.Verify(m.PublicKey, manifest, sig) {
+		return fmt.Errorf("%w: %s", ErrSignature, m.URL)
+	}
+
+	return nil
+}
+
+// Release retrieves the release of the version passed
+// from the manifest, such as to read its notes.
+func (m *ManifestSource) Release(ctx context.Context, v string) (*ManifestRelease, error) {
+	ver, err := version.NewVersion(v)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := m.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, r := range manifest.Releases {
+		if version.Must(version.NewVersion(r.Version)).Equal(ver) {
+			return &manifest.Releases[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: version %s in %s", ErrNoRelease, v, m.URL)
+}
+
+// Releases retrieves the versions within the manifest,
+// newest first.
+func (m *ManifestSource) Releases(ctx context.Context) ([]string, error) {
+	manifest, err := m.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	releases := make([]string, len(manifest.Releases))
+	for i, r := range manifest.Releases {
+		releases[i] = r.Version
+	}
+
+	return releases, nil
+}
+
+// LatestVersion retrieves the newest version within the
+// manifest.
+func (m *ManifestSource) LatestVersion(ctx context.Context) (string, error) {
+	releases, err := m.Releases(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if len(releases) == 0 {
+		return "", fmt.Errorf("no releases found in %s", m.URL)
+	}
+
+	return releases[0], nil
+}
+
+// Open downloads the asset of the release with the name
+// of the archive, preferring the asset of the running
+// platform if the name is shared. If the asset
+// has a checksum, an
+// error wrapping ErrChecksum is returned when the
+// reader reaches the end of a mismatched
+// archive.
+func (m *ManifestSource) Open(ctx context.Context, v, archive string) (io.ReadCloser, error) {
+	release, err := m.Release(ctx, v)
+	if err != nil {
+		return nil, err
+	}
+
+	asset := release.named(archive, runtime.GOOS, runtime.GOARCH)
+	if asset == nil {
+		return nil, fmt.Errorf("%w: %s for version %s in %s", ErrNoRelease, archive, v, m.URL)
+	}
+
+	download, err := m.resolve(asset.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	if sameHost(download, m.URL) {
+		header = m.Header
+	}
+
+	resp, err := sourceGet(ctx, m.Client, download, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if asset.SHA256 == "" {
+		return resp.Body, nil
+	}
+
+	return &checksumReader{
+		rc:   resp.Body,
+		hash: sha256.New(),
+		want: strings.ToLower(asset.SHA256),
+		name: asset.Name,
+	}, nil
+}
+
+// resolve returns the URL of an asset, resolving relative
+// URLs against the URL of the manifest.
+func (m *ManifestSource) resolve(asset string) (string, error) {
+	base, err := url.Parse(m.URL)
+	if err != nil {
+		return "", err
+	}
+	ref, err := url.Parse(asset)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// checksumReader hashes the archive as it is read and
+// compares the checksum once the end is reached.
+type checksumReader struct {
+	rc   io.ReadCloser
+	hash hash.Hash
+	want string
+	name string
+}
+
+// Read reads from the archive, an error wrapping
+// ErrChecksum is returned in place of io.EOF if
+// the checksum does not match.
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.rc.Read(p)
+	c.hash.Write(p[:n])
+	if err == io.EOF {
+		got := hex.EncodeToString(c.hash.Sum(nil))
+		if got != c.want {
+			return n, fmt.Errorf("%w: %s is %s, expected %s", ErrChecksum, c.name, got, c.want)
+		}
+	}
+	return n, err
+}
+
+// Close closes the archive.
+func (c *checksumReader) Close() error {
+	return c.rc.Close()
+}
@@ -0,0 +1,375 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"github.com/mouuff/go-rocket-update/pkg/updater"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// testManifest returns a stand-in of a static file host
+// serving a manifest at /releases.json, with the
+// archive passed for v0.0.2.
+func testManifest(archive []byte, checksum string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/releases.json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"releases": [
+			{"version": "v0.0.1", "assets": [{"name": "verbis.zip", "url": "v0.0.1/verbis.zip"}]},
+			{"version": "v0.0.10", "mandatory": true, "notes": "Security fix", "assets": [
+				{"name": "verbis_linux.zip", "os": "linux", "arch": "amd64", "url": "/v0.0.10/verbis_linux.zip"},
+				{"name": "verbis_darwin.zip", "os": "darwin", "arch": "arm64", "url": "/v0.0.10/verbis_darwin.zip"}
+			]},
+			{"version": "v0.0.2", "assets": [{"name": "verbis.zip", "url": "v0.0.2/verbis.zip", "sha256": "%s"}]}
+		]}`, checksum)
+	})
+	mux.HandleFunc("/v0.0.2/verbis.zip", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(archive)
+	})
+	return httptest.NewServer(mux)
+}
+
+// sha256Of returns the hex encoded SHA-256 checksum of
+// the bytes passed.
+func sha256Of(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestManifestSource_Releases(t *testing.T) {
+	ts := testManifest(nil, "")
+	defer ts.Close()
+
+	m := &ManifestSource{URL: ts.URL + "/releases.json"}
+
+	got, err := m.Releases(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"v0.0.10", "v0.0.2", "v0.0.1"}, got)
+
+	latest, err := m.LatestVersion(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "v0.0.10", latest)
+
+	release, err := m.Release(context.Background(), "0.0.10")
+	assert.NoError(t, err)
+	assert.True(t, release.Mandatory)
+	assert.Equal(t, "Security fix", release.Notes)
+	assert.Equal(t, "verbis_darwin.zip", release.Asset("darwin", "arm64").Name)
+	assert.Nil(t, release.Asset("windows", "amd64"))
+
+	_, err = m.Release(context.Background(), "v0.0.3")
+	assert.ErrorIs(t, err, ErrNoRelease)
+}
+
+func TestManifestSource_Open(t *testing.T) {
+	archive := []byte("archive")
+
+	tt := map[string]struct {
+		checksum string
+		archive  string
+		want     interface{}
+	}{
+		"Success": {
+			sha256Of(archive),
+			"verbis.zip",
+			"archive",
+		},
+		"No Checksum": {
+			"",
+			"verbis.zip",
+			"archive",
+		},
+		"Checksum Mismatch": {
+			sha256Of([]byte("wrong")),
+			"verbis.zip",
+			ErrChecksum.Error(),
+		},
+		"Not Found": {
+			"",
+			"wrong.zip",
+			ErrNoRelease.Error(),
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			ts := testManifest(archive, test.checksum)
+			defer ts.Close()
+
+			m := &ManifestSource{URL: ts.URL + "/releases.json"}
+			rc, err := m.Open(context.Background(), "v0.0.2", test.archive)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			defer rc.Close()
+
+			got, err := ioutil.ReadAll(rc)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.Equal(t, test.want, string(got))
+		})
+	}
+}
+
+func TestManifestSource_OpenPlatform(t *testing.T) {
+	other := "plan9"
+	if runtime.GOOS == other {
+		other = "linux"
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/releases.json":
+			_, _ = fmt.Fprintf(w, `{"releases": [{"version": "v0.0.2", "assets": [
+				{"name": "verbis.zip", "os": %q, "arch": %q, "url": "other/verbis.zip"},
+				{"name": "verbis.zip", "os": %q, "arch": %q, "url": "native/verbis.zip"}
+			]}]}`, other, runtime.GOARCH, runtime.GOOS, runtime.GOARCH)
+		case "/native/verbis.zip":
+			_, _ = w.Write([]byte("native"))
+		default:
+			_, _ = w.Write([]byte("other"))
+		}
+	}))
+	defer ts.Close()
+
+	m := &ManifestSource{URL: ts.URL + "/releases.json"}
+	rc, err := m.Open(context.Background(), "v0.0.2", "verbis.zip")
+	assert.NoError(t, err)
+	defer rc.Close()
+
+	got, err := ioutil.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, "native", string(got))
+}
+
+func TestManifestRelease_Named(t *testing.T) {
+	release := &ManifestRelease{Assets: []ManifestAsset{
+		{Name: "verbis.zip", OS: "linux", Arch: "amd64", URL: "linux"},
+		{Name: "verbis.zip", OS: "darwin", Arch: "arm64", URL: "darwin"},
+		{Name: "verbis_windows.zip", OS: "windows", Arch: "amd64", URL: "windows"},
+	}}
+
+	tt := map[string]struct {
+		name string
+		os   string
+		arch string
+		want interface{}
+	}{
+		"Platform": {
+			"verbis.zip",
+			"darwin",
+			"arm64",
+			"darwin",
+		},
+		"Other Platform": {
+			"verbis.zip",
+			"freebsd",
+			"amd64",
+			"linux",
+		},
+		"Name": {
+			"verbis_windows.zip",
+			"linux",
+			"amd64",
+			"windows",
+		},
+		"Not Found": {
+			"wrong.zip",
+			"linux",
+			"amd64",
+			nil,
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			got := release.named(test.name, test.os, test.arch)
+			if got == nil {
+				assert.Nil(t, test.want)
+				return
+			}
+			assert.Equal(t, test.want, got.URL)
+		})
+	}
+}
+
+func TestManifestSource_Errors(t *testing.T) {
+	tt := map[string]struct {
+		body string
+		want string
+	}{
+		"Bad JSON": {
+			`wrong`,
+			"invalid character",
+		},
+		"Bad Version": {
+			`{"releases": [{"version": "wrong"}]}`,
+			"error reading manifest",
+		},
+		"Empty": {
+			`{"releases": []}`,
+			"no releases found",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(test.body))
+			}))
+			defer ts.Close()
+
+			_, err := (&ManifestSource{URL: ts.URL}).LatestVersion(context.Background())
+			assert.Contains(t, err.Error(), test.want)
+		})
+	}
+}
+
+func TestManifestSource_Update(t *testing.T) {
+	archive := testArchive(t, map[string]string{"verbis": "new"})
+
+	tt := map[string]struct {
+		checksum string
+		want     string
+		code     Status
+	}{
+		"Success": {
+			sha256Of(archive),
+			"new",
+			Updated,
+		},
+		"Checksum Mismatch": {
+			sha256Of([]byte("wrong")),
+			"old",
+			ExecutableError,
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			var ts *httptest.Server
+			ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/verbis.zip" {
+					_, _ = w.Write(archive)
+					return
+				}
+				_, _ = fmt.Fprintf(w, `{"releases": [{"version": "v0.0.2", "assets": [
+					{"name": "verbis.zip", "url": "%s/verbis.zip", "sha256": "%s"}
+				]}]}`, ts.URL, test.checksum)
+			}))
+			defer ts.Close()
+
+			exec := filepath.Join(t.TempDir(), "verbis")
+			assert.NoError(t, ioutil.WriteFile(exec, []byte("old"), os.ModePerm))
+
+			u := Updater{
+				opts:    Options{Version: "v0.0.1", Source: &ManifestSource{URL: ts.URL + "/releases.json"}, Registry: NewRegistry()},
+				pkg:     &updater.Updater{OverrideExecutable: exec},
+				version: version.Must(version.NewVersion("v0.0.1")),
+			}
+
+			code, err := u.Update("verbis.zip")
+			assert.Equal(t, test.code, code)
+			if err != nil {
+				assert.ErrorIs(t, err, ErrChecksum)
+			}
+
+			got, err := ioutil.ReadFile(exec)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, string(got))
+		})
+	}
+}
+
+func TestManifestSource_Signature(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	other, _, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	manifest := []byte(`{"releases": [{"version": "v0.0.2"}]}`)
+
+	tt := map[string]struct {
+		key       ed25519.PublicKey
+		signature string
+		status    int
+		want      interface{}
+	}{
+		"Success": {
+			public,
+			base64.StdEncoding.EncodeToString(ed25519.Sign(private, manifest)),
+			http.StatusOK,
+			"v0.0.2",
+		},
+		"Not Verified": {
+			nil,
+			"",
+			http.StatusNotFound,
+			"v0.0.2",
+		},
+		"Wrong Key": {
+			other,
+			base64.StdEncoding.EncodeToString(ed25519.Sign(private, manifest)),
+			http.StatusOK,
+			ErrSignature.Error(),
+		},
+		"Short Key": {
+			ed25519.PublicKey("short"),
+			base64.StdEncoding.EncodeToString(ed25519.Sign(private, manifest)),
+			http.StatusOK,
+			ErrSignature.Error(),
+		},
+		"Bad Encoding": {
+			public,
+			"wrong!",
+			http.StatusOK,
+			ErrSignature.Error(),
+		},
+		"No Signature": {
+			public,
+			"",
+			http.StatusNotFound,
+			ErrSignature.Error(),
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/releases.json.sig" {
+					w.WriteHeader(test.status)
+					_, _ = w.Write([]byte(test.signature))
+					return
+				}
+				_, _ = w.Write(manifest)
+			}))
+			defer ts.Close()
+
+			m := &ManifestSource{URL: ts.URL + "/releases.json", PublicKey: test.key}
+			got, err := m.LatestVersion(context.Background())
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
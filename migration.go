@@ -5,10 +5,15 @@
 package updater
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"github.com/hashicorp/go-version"
 	"io"
+	"io/ioutil"
 	"sort"
+	"sync"
 )
 
 // Migration represents a singular migration for a single
@@ -18,6 +23,20 @@ type Migration struct {
 	Version string
 	// The migration file, byte value of the SQL migration.
 	SQL io.Reader
+	// SQLDown is the byte value of the SQL used to reverse
+	// the migration. It is executed when migrating down
+	// to an older version.
+	SQLDown io.Reader
+	// Up is a function called after the SQL has been
+	// executed, within the transaction of the
+	// migration. It can be used for data
+	// migrations written in Go.
+	Up MigrateFn
+	// Down is a function called when the migration is
+	// reversed, after the SQLDown has been executed.
+	// A migration with Up but no Down cannot be
+	// reversed.
+	Down MigrateFn
 	// CallBackUp is a function called when the migration
 	// is going up, this can be useful when manipulating
 	// files and directories for the current version.
@@ -30,8 +49,16 @@ type Migration struct {
 	// Stage defines the release stage of the migration such as
 	// Major, Minor or Patch,
 	Stage Stage
+	// Transaction defines how the migration is run in
+	// relation to database transactions, defaults
+	// to TxShared.
+	Transaction TxMode
 }
 
+// sqlMu guards reading the SQL of migrations, which may
+// be run by more than one Updater at a time.
+var sqlMu sync.Mutex
+
 // CallBackFn is the function type when migrations are
 // running up or down.
 type CallBackFn func() error
@@ -40,10 +67,6 @@ type CallBackFn func() error
 // migration.
 type MigrationRegistry []*Migration
 
-// migrations is the in memory registry store of
-// migrations.
-var migrations = make(MigrationRegistry, 0)
-
 var (
 	// ErrCallBackMismatch is returned by AddMigration when
 	// there has been a mismatch in the amount of callbacks
@@ -52,54 +75,30 @@ var (
 	ErrCallBackMismatch = errors.New("both CallBackUp and CallBackDown must be set")
 )
 
-// AllMigrations returns all migrations in the
+// AllMigrations returns all migrations in the default
 // registry.
 func AllMigrations() MigrationRegistry {
-	return migrations
+	return defaultRegistry.All()
 }
 
-// GetMigration Retrieves a migration from the registry by
-// looking up the version. An error will be returned on
-// failed lookup.
+// GetMigration Retrieves a migration from the default
+// registry by looking up the version. An error will
+// be returned on failed lookup.
 func GetMigration(version string) (*Migration, error) { //nolint
-	for _, m := range migrations {
-		if m.Version == version {
-			return m, nil
-		}
-	}
-	return nil, errors.New("no migration found with the version: " + version)
+	return defaultRegistry.Get(version)
 }
 
-// AddMigration adds a migration to the update registry
+// AddMigration adds a migration to the default registry
 // which will be called when Update() is run. The
 // version and Stage must be attached to the
 // migration.
 func AddMigration(m *Migration) error {
-	if m.Version == "" {
-		return errors.New("no version provided for update")
-	}
-
-	if m.Stage == "" {
-		return errors.New("no stage set")
-	}
-
-	if m.CallBackUp != nil && m.CallBackDown == nil {
-		return ErrCallBackMismatch
-	}
-
-	if m.CallBackUp == nil && m.CallBackDown != nil {
-		return ErrCallBackMismatch
-	}
-
-	_ = m.toSemVer() // Check to see if the version is valid
-
-	migrations = append(migrations, m)
-
-	return nil
+	return defaultRegistry.Add(m)
 }
 
 // toSemVer parses the migration to version.Version, and
-// panics if the version is malformed.
+// panics if the version is malformed. Versions are
+// checked when added to a Registry.
 func (m *Migration) toSemVer() *version.Version {
 	semver, err := version.NewVersion(m.Version)
 	if err != nil {
@@ -108,6 +107,41 @@ func (m *Migration) toSemVer() *version.Version {
 	return semver
 }
 
+// up reads the SQL of the migration, an empty string is
+// returned if there is none. The reader is replaced so
+// the SQL can be read again.
+func (m *Migration) up() (string, error) {
+	sqlMu.Lock()
+	defer sqlMu.Unlock()
+	if m.SQL == nil {
+		return "", nil
+	}
+	buf, err := ioutil.ReadAll(m.SQL)
+	if err != nil {
+		return "", err
+	}
+	m.SQL = bytes.NewReader(buf)
+	return string(buf), nil
+}
+
+// checksum returns the hex encoded SHA-256 hash of the
+// SQL of the migration, an empty string is returned
+// if there is none.
+func (m *Migration) checksum() (string, error) {
+	sql, err := m.up()
+	if err != nil || sql == "" {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(sql))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// irreversible returns true if the migration has SQL or
+// an Up function without the means to reverse it.
+func (m *Migration) irreversible() bool {
+	return (m.SQL != nil && m.SQLDown == nil) || (m.Up != nil && m.Down == nil)
+}
+
 // hasCallBack returns true if CallBackUp and CallBackDown
 // are both defined.
 func (m *Migration) hasCallBack() bool {
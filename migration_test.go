@@ -31,9 +31,9 @@ func TestGetMigration(t *testing.T) {
 
 	for name, test := range tt {
 		t.Run(name, func(t *testing.T) {
-			migrations = []*Migration{&test.migration}
+			defaultRegistry = testRegistry(MigrationRegistry{&test.migration})
 			defer func() {
-				migrations = make(MigrationRegistry, 0)
+				defaultRegistry = NewRegistry()
 			}()
 			got, err := GetMigration(test.input)
 			if err != nil {
@@ -66,6 +66,14 @@ func TestAddMigration(t *testing.T) {
 			Migration{Version: "v1.3.3.3", SQL: strings.NewReader("test"), Stage: Minor},
 			"invalid version",
 		},
+		"Malformed version": {
+			Migration{Version: "wrong", Stage: Minor},
+			"invalid version",
+		},
+		"Invalid Stage": {
+			Migration{Version: "v0.0.1", Stage: "wrong"},
+			ErrInvalidStage.Error(),
+		},
 		"No CallBackUp": {
 			Migration{Version: "v0.0.1", SQL: strings.NewReader("test"), Stage: Minor, CallBackDown: func() error {
 				return nil
@@ -83,14 +91,14 @@ func TestAddMigration(t *testing.T) {
 	for name, test := range tt {
 		t.Run(name, func(t *testing.T) {
 			defer func() {
-				migrations = make(MigrationRegistry, 0)
+				defaultRegistry = NewRegistry()
 			}()
 			err := AddMigration(&test.input)
 			if err != nil {
 				assert.Contains(t, err.Error(), test.want)
 				return
 			}
-			assert.Equal(t, test.input, *migrations[0])
+			assert.Equal(t, test.input, *AllMigrations()[0])
 		})
 	}
 }
@@ -178,3 +186,23 @@ func TestMigration_HasCallBack(t *testing.T) {
 		})
 	}
 }
+
+func TestMigration_Checksum(t *testing.T) {
+	m := &Migration{SQL: strings.NewReader(v001)}
+
+	got, err := m.checksum()
+	assert.NoError(t, err)
+	assert.Len(t, got, 64)
+
+	again, err := m.checksum()
+	assert.NoError(t, err)
+	assert.Equal(t, got, again)
+
+	sql, err := m.up()
+	assert.NoError(t, err)
+	assert.Equal(t, v001, sql)
+
+	empty, err := (&Migration{}).checksum()
+	assert.NoError(t, err)
+	assert.Equal(t, "", empty)
+}
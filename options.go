@@ -9,13 +9,18 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 )
 
 // Options define the core arguments parsed to the migrator.
 type Options struct {
 	// The URL of the GitHub Repository to obtain the
-	// executable from.
+	// executable from, required if no Source is set.
 	GithubURL string
+	// Source retrieves the releases of the executable,
+	// the GitHub repository of the GithubURL is
+	// used if nil.
+	Source Source
 	// The currently running version.
 	Version string
 	// If set to true, updates will be verified by checking the
@@ -25,6 +30,40 @@ type Options struct {
 	// SQL database to apply migrations, migrations will not
 	// be run if sql.DB is nil.
 	DB *sql.DB
+	// Dialect of the database such as Postgres, MySQL or
+	// SQLite. If nil, the dialect will be detected
+	// from the database driver.
+	Dialect Dialect
+	// The amount of time to wait for the migration lock
+	// when another instance is migrating, defaults to
+	// DefaultLockTimeout.
+	LockTimeout time.Duration
+	// If set to true, Update will not run any migrations,
+	// instead a pending marker is written next to the
+	// executable. The newly installed executable must
+	// call ResumePending on start up to apply the
+	// migrations from its own registry.
+	DeferMigrations bool
+	// If set to true, Update will run the newly installed
+	// executable with the MigrateFlag to apply the
+	// migrations from its own registry. The
+	// executable must call HandleMigrate
+	// from main.
+	DelegateMigrations bool
+	// If set to true, migrations are refused with the
+	// Drifted status when the SQL of an applied
+	// migration has changed since it was run,
+	// see Drift.
+	RefuseDrift bool
+	// Policy defines which stages of a release are applied
+	// automatically, every stage is applied if empty.
+	Policy Policy
+	// Registry contains the migrations to run, the default
+	// registry used by AddMigration is used if nil.
+	Registry *Registry
+	// Logger is passed to the Up and Down functions of
+	// migrations, nothing is logged if nil.
+	Logger Logger
 	// Determines if the database is set.
 	hasDB bool
 }
@@ -38,7 +77,7 @@ var (
 // Validate check's to see if the options are valid before
 // returning a new migrator.
 func (o *Options) Validate() error {
-	if o.GithubURL == "" {
+	if o.GithubURL == "" && o.Source == nil {
 		return errors.New("no repo url provided")
 	}
 
@@ -46,13 +85,19 @@ func (o *Options) Validate() error {
 		return errors.New("no version provided")
 	}
 
-	resp, err := http.Get(o.GithubURL)
-	if err != nil {
-		return fmt.Errorf("%w: %s", ErrRepositoryURL, err.Error())
+	if o.DeferMigrations && o.DelegateMigrations {
+		return errors.New("only one of DeferMigrations and DelegateMigrations can be set")
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return ErrRepositoryURL
+	if o.Source == nil {
+		resp, err := http.Get(o.GithubURL)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrRepositoryURL, err.Error())
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return ErrRepositoryURL
+		}
 	}
 
 	if o.DB != nil {
@@ -61,6 +106,9 @@ func (o *Options) Validate() error {
 			return err
 		}
 		o.hasDB = true
+		if o.Dialect == nil {
+			o.Dialect = detectDialect(o.DB)
+		}
 	}
 
 	return nil
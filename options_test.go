@@ -34,12 +34,24 @@ func TestOptions_Validate(t *testing.T) {
 			nil,
 			"no repo url provided",
 		},
+		"Source": {
+			Options{Source: &mockSource{}, Version: "0.0.1"},
+			nil,
+			nil,
+			nil,
+		},
 		"No version": {
 			Options{GithubURL: "url"},
 			nil,
 			nil,
 			"no version provided",
 		},
+		"Defer And Delegate": {
+			Options{GithubURL: "url", Version: "0.0.1", DeferMigrations: true, DelegateMigrations: true},
+			nil,
+			nil,
+			"only one of DeferMigrations and DelegateMigrations",
+		},
 		"Bad URL": {
 			Options{GithubURL: "https://", Version: "0.0.1"},
 			func(w http.ResponseWriter, r *http.Request) {
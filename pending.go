@@ -0,0 +1,151 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// pendingMarker is the file written next to the executable
+// by Update when migrations have been deferred to the
+// newly installed executable.
+type pendingMarker struct {
+	// The version that was running before the update.
+	From string `json:"from"`
+	// The version that was installed.
+	To string `json:"to"`
+	// The time the marker was written.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+var (
+	// ErrPendingVersion is returned by ResumePending when
+	// the running version does not match the version
+	// that was installed by Update.
+	ErrPendingVersion = errors.New("pending migration version mismatch")
+)
+
+// pendingPath returns the path of the marker file, which
+// is stored alongside the executable.
+func (u *Updater) pendingPath() (string, error) {
+	executable, err := u.pkg.GetExecutable()
+	if err != nil {
+		return "", err
+	}
+	return executable + ".pending", nil
+}
+
+// writePending writes the pending marker for the version
+// that has been installed.
+func (u *Updater) writePending(to string) error {
+	path, err := u.pendingPath()
+	if err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(pendingMarker{
+		From:      u.opts.Version,
+		To:        to,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, buf, 0644)
+}
+
+// readPending reads the pending marker, nil is returned
+// if there is no marker.
+func (u *Updater) readPending() (*pendingMarker, error) {
+	path, err := u.pendingPath()
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var marker pendingMarker
+	err = json.Unmarshal(buf, &marker)
+	if err != nil {
+		return nil, err
+	}
+
+	return &marker, nil
+}
+
+// ResumePending applies the migrations that were deferred
+// by Update when DeferMigrations is set. It should be
+// called by the newly installed executable on start
+// up, so the migrations of its own registry are run
+// from the version recorded by the previous
+// executable. UpToDate is returned if there
+// are no pending migrations.
+//
+// If a migration fails, the executable is rolled back
+// to the previous one and the marker is removed. The
+// application should exit so the previous executable
+// can be started again.
+func (u *Updater) ResumePending() (Status, error) {
+	return u.ResumePendingContext(context.Background())
+}
+
+// ResumePendingContext is ResumePending with a context
+// that bounds running the migrations.
+func (u *Updater) ResumePendingContext(ctx context.Context) (Status, error) {
+	marker, err := u.readPending()
+	if err != nil {
+		return Unknown, err
+	}
+
+	if marker == nil {
+		return UpToDate, nil
+	}
+
+	to, err := version.NewVersion(marker.To)
+	if err != nil {
+		return Unknown, err
+	}
+
+	if !to.Equal(u.version) {
+		return Unknown, fmt.Errorf("%w: expected %s, running %s", ErrPendingVersion, marker.To, u.opts.Version)
+	}
+
+	from, err := version.NewVersion(marker.From)
+	if err != nil {
+		return Unknown, err
+	}
+
+	path, err := u.pendingPath()
+	if err != nil {
+		return Unknown, err
+	}
+
+	status, err := u.runMigrations(ctx, from, u.version)
+	if err != nil {
+		_ = u.pkg.Rollback()
+		_ = os.Remove(path)
+		return status, err
+	}
+
+	err = os.Remove(path)
+	if err != nil {
+		return Unknown, err
+	}
+
+	return status, nil
+}
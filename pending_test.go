@@ -0,0 +1,144 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"github.com/mouuff/go-rocket-update/pkg/updater"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdater_ResumePending(t *testing.T) {
+	tt := map[string]struct {
+		marker string
+		input  MigrationRegistry
+		want   interface{}
+		code   Status
+		exec   string
+	}{
+		"No Marker": {
+			"",
+			nil,
+			nil,
+			UpToDate,
+			"new",
+		},
+		"Success": {
+			`{"from": "v0.0.1", "to": "v0.0.2"}`,
+			MigrationRegistry{
+				&Migration{Version: "v0.0.2", Stage: Patch, CallBackUp: func() error {
+					return nil
+				}, CallBackDown: func() error {
+					return nil
+				}},
+			},
+			nil,
+			Updated,
+			"new",
+		},
+		"No Prefix": {
+			`{"from": "0.0.1", "to": "0.0.2"}`,
+			nil,
+			nil,
+			Updated,
+			"new",
+		},
+		"Bad Marker": {
+			`wrong`,
+			nil,
+			"invalid character",
+			Unknown,
+			"new",
+		},
+		"Version Mismatch": {
+			`{"from": "v0.0.1", "to": "v0.0.3"}`,
+			nil,
+			ErrPendingVersion.Error(),
+			Unknown,
+			"new",
+		},
+		"Bad To": {
+			`{"from": "v0.0.1", "to": "wrong"}`,
+			nil,
+			"Malformed version",
+			Unknown,
+			"new",
+		},
+		"Bad From": {
+			`{"from": "wrong", "to": "v0.0.2"}`,
+			nil,
+			"Malformed version",
+			Unknown,
+			"new",
+		},
+		"Migration Error": {
+			`{"from": "v0.0.1", "to": "v0.0.2"}`,
+			MigrationRegistry{
+				&Migration{Version: "v0.0.2", Stage: Patch, CallBackUp: func() error {
+					return fmt.Errorf("callback error")
+				}, CallBackDown: func() error {
+					return nil
+				}},
+			},
+			"callback error",
+			CallBackError,
+			"old",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			exec := filepath.Join(t.TempDir(), "verbis")
+			assert.NoError(t, ioutil.WriteFile(exec, []byte("new"), os.ModePerm))
+			assert.NoError(t, ioutil.WriteFile(exec+".old", []byte("old"), os.ModePerm))
+			if test.marker != "" {
+				assert.NoError(t, ioutil.WriteFile(exec+".pending", []byte(test.marker), os.ModePerm))
+			}
+
+			registry := testRegistry(test.input)
+
+			u := Updater{
+				opts:    Options{Version: "v0.0.2", Registry: registry},
+				pkg:     &updater.Updater{OverrideExecutable: exec},
+				version: version.Must(version.NewVersion("v0.0.2")),
+			}
+
+			code, err := u.ResumePending()
+			assert.Equal(t, test.code, code)
+
+			got, readErr := ioutil.ReadFile(exec)
+			assert.NoError(t, readErr)
+			assert.Equal(t, test.exec, string(got))
+
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+
+			assert.NoFileExists(t, exec+".pending")
+		})
+	}
+}
+
+func TestUpdater_WritePending(t *testing.T) {
+	exec := filepath.Join(t.TempDir(), "verbis")
+	u := Updater{
+		opts: Options{Version: "v0.0.1"},
+		pkg:  &updater.Updater{OverrideExecutable: exec},
+	}
+
+	err := u.writePending("v0.0.2")
+	assert.NoError(t, err)
+
+	got, err := u.readPending()
+	assert.NoError(t, err)
+	assert.Equal(t, "v0.0.1", got.From)
+	assert.Equal(t, "v0.0.2", got.To)
+}
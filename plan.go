@@ -0,0 +1,210 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-version"
+)
+
+// Plan describes what Update would do for an archive,
+// without downloading or executing anything.
+type Plan struct {
+	// The currently running version.
+	Current string `json:"current"`
+	// The latest version of the release.
+	Latest string `json:"latest"`
+	// UpToDate is true when the latest version is not
+	// newer than the currently running version, the
+	// executable will not be replaced.
+	UpToDate bool `json:"up_to_date"`
+	// The stage of the release relative to the currently
+	// running version, empty if up to date.
+	Stage Stage `json:"stage,omitempty"`
+	// ApprovalRequired is true when the release or one of
+	// the migrations must be approved before Update
+	// applies it, see Policy.
+	ApprovalRequired bool `json:"approval_required"`
+	// The archive name of the release asset.
+	Archive string `json:"archive"`
+	// The URL the archive would be downloaded from, empty
+	// if the Source is not a URLSource.
+	URL string `json:"url"`
+	// How the migrations would be run, either "run",
+	// "defer" or "delegate". When deferred or
+	// delegated, the migrations are those of the
+	// new executable rather than the ones
+	// listed below.
+	Mode string `json:"mode"`
+	// The migrations that would be run in order.
+	Migrations []PlanMigration `json:"migrations"`
+	// The steps that would be taken to roll back if the
+	// final migration failed, in order.
+	Rollback []string `json:"rollback"`
+}
+
+// PlanMigration describes a migration that would be run
+// by Update.
+type PlanMigration struct {
+	Version     string `json:"version"`
+	Stage       Stage  `json:"stage"`
+	SQL         bool   `json:"sql"`
+	SQLDown     bool   `json:"sql_down"`
+	CallBacks   bool   `json:"callbacks"`
+	Functions   bool   `json:"functions"`
+	Transaction string `json:"transaction"`
+}
+
+// Plan resolves the latest release and returns the
+// archive that would be downloaded, the migrations
+// that would be run and the steps that would be
+// taken to roll back if they failed. Nothing is
+// downloaded or executed. ErrDirty is returned
+// if the database is in a dirty state, as
+// Update would refuse to run.
+func (u *Updater) Plan(archive string) (*Plan, error) {
+	return u.PlanContext(context.Background(), archive)
+}
+
+// PlanContext is Plan with a context that bounds the
+// requests made to resolve the latest release.
+func (u *Updater) PlanContext(ctx context.Context, archive string) (*Plan, error) {
+	latest, err := u.LatestVersionContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := version.NewVersion(latest)
+	if err != nil {
+		return nil, err
+	}
+
+	var url string
+	if s, ok := u.source().(URLSource); ok {
+		url, err = s.URL(latest, archive)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var applied history
+	if u.opts.hasDB {
+		applied, err = u.readHistory(ctx)
+		if err != nil {
+			return nil, err
+		}
+		err = applied.checkDirty()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &Plan{
+		Current:    u.opts.Version,
+		Latest:     latest,
+		UpToDate:   !target.GreaterThan(u.version),
+		Archive:    archive,
+		URL:        url,
+		Mode:       "run",
+		Migrations: make([]PlanMigration, 0),
+	}
+
+	switch {
+	case u.opts.DeferMigrations && !plan.UpToDate:
+		plan.Mode = "defer"
+	case u.opts.DelegateMigrations && !plan.UpToDate:
+		plan.Mode = "delegate"
+	}
+
+	if !plan.UpToDate {
+		plan.Stage = stageBetween(u.version, target)
+	}
+
+	ms := pending(u.registry().All(), applied, u.version, target)
+	plan.ApprovalRequired = errors.Is(u.checkPolicy(target, ms), ErrApprovalRequired)
+
+	for _, m := range ms {
+		plan.Migrations = append(plan.Migrations, PlanMigration{
+			Version:     m.Version,
+			Stage:       u.registry().Stage(m),
+			SQL:         m.SQL != nil,
+			SQLDown:     m.SQLDown != nil,
+			CallBacks:   m.hasCallBack(),
+			Functions:   m.Up != nil || m.Down != nil,
+			Transaction: txMode(m, u.dialect().TransactionalDDL()).String(),
+		})
+	}
+
+	plan.Rollback = u.rollbackSteps(ms)
+	if !plan.UpToDate {
+		plan.Rollback = append(plan.Rollback, "restore the executable to "+u.opts.Version)
+	}
+
+	return plan, nil
+}
+
+// rollbackSteps returns the steps that would be taken by
+// fail if the final migration passed failed, following
+// the transaction mode of each migration.
+func (u *Updater) rollbackSteps(ms MigrationRegistry) []string {
+	steps := make([]string, 0)
+	if len(ms) == 0 {
+		return steps
+	}
+
+	ddl := u.dialect().TransactionalDDL()
+
+	var uncommitted, committed MigrationRegistry
+	for _, m := range ms[:len(ms)-1] {
+		if !u.opts.hasDB || txMode(m, ddl) == TxShared {
+			uncommitted = append(uncommitted, m)
+			continue
+		}
+		committed = append(committed, uncommitted...)
+		committed = append(committed, m)
+		uncommitted = nil
+	}
+
+	last := ms[len(ms)-1]
+	if u.opts.hasDB {
+		switch txMode(last, ddl) {
+		case TxNone:
+			return append(steps, "mark the database as dirty at "+last.Version)
+		case TxOwn:
+			if !ddl {
+				return append(steps, "roll back the transaction", "mark the database as dirty at "+last.Version)
+			}
+			committed = append(committed, uncommitted...)
+			uncommitted = nil
+		}
+		steps = append(steps, "roll back the transaction")
+	}
+
+	for i := len(uncommitted) - 1; i >= 0; i-- {
+		if uncommitted[i].hasCallBack() {
+			steps = append(steps, "call CallBackDown of "+uncommitted[i].Version)
+		}
+	}
+
+	for i := len(committed) - 1; i >= 0; i-- {
+		m := committed[i]
+		if m.irreversible() {
+			return append(steps, fmt.Sprintf("mark the database as dirty, %s cannot be reversed", m.Version))
+		}
+		if m.SQLDown != nil {
+			steps = append(steps, "run SQLDown of "+m.Version)
+		}
+		if m.Down != nil {
+			steps = append(steps, "run Down of "+m.Version)
+		}
+		if m.hasCallBack() {
+			steps = append(steps, "call CallBackDown of "+m.Version)
+		}
+	}
+
+	return steps
+}
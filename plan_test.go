@@ -0,0 +1,287 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestUpdater_Plan(t *testing.T) {
+	callback := func() error { return nil }
+
+	tt := map[string]struct {
+		source  Source
+		opts    Options
+		version string
+		mock    func(m sqlmock.Sqlmock)
+		want    interface{}
+	}{
+		"Success": {
+			&mockSource{},
+			Options{GithubURL: "https://github.com/ainsleyclark/test", Version: "v0.0.0", hasDB: true},
+			"v0.0.0",
+			func(m sqlmock.Sqlmock) {
+				m.ExpectQuery("SELECT version, success, dirty, checksum FROM " + historyTable).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "success", "dirty", "checksum"}))
+			},
+			&Plan{
+				Current:  "v0.0.0",
+				Stage:    Patch,
+				Latest:   TestVersion,
+				Archive:  "archive.zip",
+				URL:      "https://example.com/v0.0.1/archive.zip",
+				Mode:     "run",
+				Rollback: []string{"roll back the transaction", "restore the executable to v0.0.0"},
+				Migrations: []PlanMigration{
+					{Version: "v0.0.1", Stage: Patch, SQL: true, SQLDown: true, CallBacks: true, Transaction: "shared"},
+				},
+			},
+		},
+		"No History": {
+			&mockSource{},
+			Options{GithubURL: "https://github.com/ainsleyclark/test", Version: "v0.0.0", hasDB: true},
+			"v0.0.0",
+			func(m sqlmock.Sqlmock) {
+				m.ExpectQuery("SELECT version, success, dirty, checksum FROM " + historyTable).
+					WillReturnError(fmt.Errorf("no such table: " + historyTable))
+			},
+			&Plan{
+				Current:  "v0.0.0",
+				Stage:    Patch,
+				Latest:   TestVersion,
+				Archive:  "archive.zip",
+				URL:      "https://example.com/v0.0.1/archive.zip",
+				Mode:     "run",
+				Rollback: []string{"roll back the transaction", "restore the executable to v0.0.0"},
+				Migrations: []PlanMigration{
+					{Version: "v0.0.1", Stage: Patch, SQL: true, SQLDown: true, CallBacks: true, Transaction: "shared"},
+				},
+			},
+		},
+		"History Error": {
+			&mockSource{},
+			Options{GithubURL: "https://github.com/ainsleyclark/test", Version: "v0.0.0", hasDB: true},
+			"v0.0.0",
+			func(m sqlmock.Sqlmock) {
+				m.ExpectQuery("SELECT version, success, dirty, checksum FROM " + historyTable).
+					WillReturnError(fmt.Errorf("history error"))
+			},
+			"history error",
+		},
+		"Approval Required": {
+			&mockSource{},
+			Options{GithubURL: "https://github.com/ainsleyclark/test", Version: "v0.0.0", Policy: Policy{AutoApply: []Stage{Minor}}},
+			"v0.0.0",
+			nil,
+			&Plan{
+				Current:          "v0.0.0",
+				Latest:           TestVersion,
+				Stage:            Patch,
+				ApprovalRequired: true,
+				Archive:          "archive.zip",
+				URL:              "https://example.com/v0.0.1/archive.zip",
+				Mode:             "run",
+				Rollback:         []string{"restore the executable to v0.0.0"},
+				Migrations: []PlanMigration{
+					{Version: "v0.0.1", Stage: Patch, SQL: true, SQLDown: true, CallBacks: true, Transaction: "shared"},
+				},
+			},
+		},
+		"Up To Date": {
+			&mockSource{},
+			Options{GithubURL: "https://github.com/ainsleyclark/test", Version: "v0.0.1", DeferMigrations: true},
+			"v0.0.1",
+			nil,
+			&Plan{
+				Current:    "v0.0.1",
+				Latest:     TestVersion,
+				UpToDate:   true,
+				Archive:    "archive.zip",
+				URL:        "https://example.com/v0.0.1/archive.zip",
+				Mode:       "run",
+				Rollback:   []string{},
+				Migrations: []PlanMigration{},
+			},
+		},
+		"Deferred": {
+			&mockSource{},
+			Options{GithubURL: "https://github.com/ainsleyclark/test", Version: "v0.0.0", DeferMigrations: true},
+			"v0.0.0",
+			nil,
+			"defer",
+		},
+		"Provider Error": {
+			&mockSourceErr{},
+			Options{GithubURL: "https://github.com/ainsleyclark/test", Version: "v0.0.0"},
+			"v0.0.0",
+			nil,
+			"error",
+		},
+		"Bad URL": {
+			&GithubSource{RepositoryURL: "wrong"},
+			Options{GithubURL: "wrong", Version: "v0.0.0"},
+			"v0.0.0",
+			nil,
+			ErrGithubURL.Error(),
+		},
+		"Dirty": {
+			&mockSource{},
+			Options{GithubURL: "https://github.com/ainsleyclark/test", Version: "v0.0.0", hasDB: true},
+			"v0.0.0",
+			func(m sqlmock.Sqlmock) {
+				m.ExpectQuery("SELECT version, success, dirty, checksum FROM " + historyTable).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "success", "dirty", "checksum"}).
+						AddRow("v0.0.0", true, false, "").
+						AddRow("v0.0.1", false, true, ""))
+			},
+			ErrDirty.Error(),
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			if test.mock != nil {
+				test.mock(mock)
+			}
+
+			registry := testRegistry(MigrationRegistry{
+				&Migration{
+					Version:      "v0.0.1",
+					SQL:          strings.NewReader(v001),
+					SQLDown:      strings.NewReader(v001Down),
+					CallBackUp:   callback,
+					CallBackDown: callback,
+					Stage:        Patch,
+				},
+			})
+
+			test.opts.DB = db
+			test.opts.Registry = registry
+			test.opts.Source = test.source
+			u := Updater{
+				opts:    test.opts,
+				version: version.Must(version.NewVersion(test.version)),
+			}
+
+			got, err := u.Plan("archive.zip")
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			if mode, ok := test.want.(string); ok {
+				assert.Equal(t, mode, got.Mode)
+				return
+			}
+			assert.Equal(t, test.want, got)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdater_RollbackSteps(t *testing.T) {
+	callback := func() error { return nil }
+
+	tt := map[string]struct {
+		input MigrationRegistry
+		db    bool
+		want  []string
+	}{
+		"None": {
+			nil,
+			true,
+			[]string{},
+		},
+		"No DB": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", CallBackUp: callback, CallBackDown: callback},
+				&Migration{Version: "v0.0.2", CallBackUp: callback, CallBackDown: callback},
+			},
+			false,
+			[]string{"call CallBackDown of v0.0.1"},
+		},
+		"Shared": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), CallBackUp: callback, CallBackDown: callback},
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002)},
+			},
+			true,
+			[]string{"roll back the transaction", "call CallBackDown of v0.0.1"},
+		},
+		"Own": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), SQLDown: strings.NewReader(v001Down)},
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), SQLDown: strings.NewReader(v002Down), Transaction: TxOwn},
+				&Migration{Version: "v0.0.3", SQL: strings.NewReader(v002), Transaction: TxOwn},
+			},
+			true,
+			[]string{"roll back the transaction", "run SQLDown of v0.0.2", "run SQLDown of v0.0.1"},
+		},
+		"Irreversible": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Transaction: TxOwn},
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002)},
+			},
+			true,
+			[]string{"roll back the transaction", "mark the database as dirty, v0.0.1 cannot be reversed"},
+		},
+		"No Transaction": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001)},
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), Transaction: TxNone},
+			},
+			true,
+			[]string{"mark the database as dirty at v0.0.2"},
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			u := Updater{opts: Options{hasDB: test.db}}
+			got := u.rollbackSteps(test.input)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestUpdater_RollbackStepsMySQL(t *testing.T) {
+	callback := func() error { return nil }
+
+	tt := map[string]struct {
+		input MigrationRegistry
+		want  []string
+	}{
+		"Shared": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), SQLDown: strings.NewReader(v001Down), CallBackUp: callback, CallBackDown: callback},
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002)},
+			},
+			[]string{"roll back the transaction", "mark the database as dirty at v0.0.2"},
+		},
+		"No Transaction": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001)},
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), Transaction: TxNone},
+			},
+			[]string{"mark the database as dirty at v0.0.2"},
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			u := Updater{opts: Options{hasDB: true, Dialect: MySQL}}
+			got := u.rollbackSteps(test.input)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-version"
+)
+
+// Policy defines which stages of a release are applied
+// automatically by Update. Releases, or migrations,
+// of any other stage must be approved by calling
+// Approve before they are applied.
+type Policy struct {
+	// The stages that are applied without approval such
+	// as Patch and Minor. Every stage is applied
+	// automatically if empty.
+	AutoApply []Stage
+}
+
+var (
+	// ErrApprovalRequired is returned when a release or a
+	// pending migration crosses a stage that is not
+	// applied automatically by the Policy.
+	ErrApprovalRequired = errors.New("approval required")
+)
+
+// allows returns true if the stage is applied without
+// approval.
+func (p Policy) allows(s Stage) bool {
+	if len(p.AutoApply) == 0 {
+		return true
+	}
+	for _, stage := range p.AutoApply {
+		if stage == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Approve approves the release of the version passed, so
+// it is applied by Update even if the Policy requires
+// approval for its stage.
+func (u *Updater) Approve(v string) error {
+	ver, err := version.NewVersion(v)
+	if err != nil {
+		return err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.approved == nil {
+		u.approved = make(map[string]bool)
+	}
+	u.approved[ver.String()] = true
+	return nil
+}
+
+// isApproved determines if the version passed has been
+// approved by calling Approve.
+func (u *Updater) isApproved(v *version.Version) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.approved[v.String()]
+}
+
+// checkPolicy returns ErrApprovalRequired if the release
+// of the target version, or any of the migrations
+// passed, are of a stage that is not applied
+// automatically and the target has not been
+// approved.
+func (u *Updater) checkPolicy(target *version.Version, ms MigrationRegistry) error {
+	if u.isApproved(target) {
+		return nil
+	}
+
+	policy := u.opts.Policy
+
+	if target.GreaterThan(u.version) {
+		stage := stageBetween(u.version, target)
+		if !policy.allows(stage) {
+			return fmt.Errorf("%w: %s release %s", ErrApprovalRequired, stage, target.Original())
+		}
+	}
+
+	for _, m := range ms {
+		stage := u.registry().Stage(m)
+		if !policy.allows(stage) {
+			return fmt.Errorf("%w: %s migration %s", ErrApprovalRequired, stage, m.Version)
+		}
+	}
+
+	return nil
+}
+
+// pendingMigrations returns the migrations that would be
+// run by Update when updating to the target.
+func (u *Updater) pendingMigrations(ctx context.Context, target *version.Version) (MigrationRegistry, error) {
+	var applied history
+	if u.opts.hasDB {
+		var err error
+		applied, err = u.readHistory(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pending(u.registry().All(), applied, u.version, target), nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPolicy_Allows(t *testing.T) {
+	tt := map[string]struct {
+		policy Policy
+		input  Stage
+		want   bool
+	}{
+		"Empty": {
+			Policy{},
+			Major,
+			true,
+		},
+		"Allowed": {
+			Policy{AutoApply: []Stage{Patch, Minor}},
+			Minor,
+			true,
+		},
+		"Not Allowed": {
+			Policy{AutoApply: []Stage{Patch, Minor}},
+			Major,
+			false,
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			got := test.policy.allows(test.input)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestUpdater_CheckPolicy(t *testing.T) {
+	policy := Policy{AutoApply: []Stage{Patch, Minor}}
+
+	tt := map[string]struct {
+		target  string
+		input   MigrationRegistry
+		approve string
+		want    interface{}
+	}{
+		"Patch": {
+			"v1.0.1",
+			MigrationRegistry{&Migration{Version: "v1.0.1", Stage: Patch}},
+			"",
+			nil,
+		},
+		"Minor": {
+			"v1.1.0",
+			nil,
+			"",
+			nil,
+		},
+		"Major Release": {
+			"v2.0.0",
+			nil,
+			"",
+			"major release v2.0.0",
+		},
+		"Major Migration": {
+			"v1.0.1",
+			MigrationRegistry{&Migration{Version: "v1.0.1", Stage: Major}},
+			"",
+			"major migration v1.0.1",
+		},
+		"Up To Date": {
+			"v1.0.0",
+			nil,
+			"",
+			nil,
+		},
+		"Approved": {
+			"v2.0.0",
+			MigrationRegistry{&Migration{Version: "v2.0.0", Stage: Major}},
+			"2.0.0",
+			nil,
+		},
+		"Approved Other": {
+			"v2.0.0",
+			nil,
+			"v3.0.0",
+			"major release v2.0.0",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			u := Updater{
+				opts:    Options{Policy: policy},
+				version: version.Must(version.NewVersion("v1.0.0")),
+			}
+			if test.approve != "" {
+				assert.NoError(t, u.Approve(test.approve))
+			}
+			err := u.checkPolicy(version.Must(version.NewVersion(test.target)), test.input)
+			if test.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrApprovalRequired)
+			assert.Contains(t, err.Error(), test.want)
+		})
+	}
+}
+
+func TestUpdater_Approve(t *testing.T) {
+	u := Updater{}
+	err := u.Approve("wrong")
+	assert.Error(t, err)
+	assert.Empty(t, u.approved)
+}
+
+func TestUpdater_UpdateApprovalRequired(t *testing.T) {
+	u := Updater{
+		opts: Options{
+			GithubURL: "https://github.com/ainsleyclark/verbis",
+			Version:   "v0.0.0",
+			Policy:    Policy{AutoApply: []Stage{Minor}},
+			Registry:  NewRegistry(),
+			Source:    &mockSource{},
+		},
+		version: version.Must(version.NewVersion("v0.0.0")),
+	}
+
+	got, err := u.HasUpdate()
+	assert.ErrorIs(t, err, ErrApprovalRequired)
+	assert.False(t, got)
+
+	status, err := u.Update("verbis.zip")
+	assert.ErrorIs(t, err, ErrApprovalRequired)
+	assert.Equal(t, Status(ApprovalRequired), status)
+}
@@ -0,0 +1,355 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registry stores the migrations run by an Updater. It is
+// safe for concurrent use, so migrations can be added
+// from multiple goroutines.
+type Registry struct {
+	// InferStage allows migrations to be added without a
+	// Stage, it is then inferred from the version bump
+	// from the previous migration in the registry.
+	// The migration itself is left unchanged. It
+	// must be set before any are added.
+	InferStage bool
+	mu         sync.RWMutex
+	migrations MigrationRegistry
+	inferred   map[*Migration]Stage
+}
+
+var (
+	// ErrInvalidVersion is returned when the version of a
+	// migration is not in the form of major.minor.patch.
+	ErrInvalidVersion = errors.New("invalid version")
+	// ErrDuplicateVersion is returned when a migration has
+	// already been added with the same version.
+	ErrDuplicateVersion = errors.New("duplicate migration version")
+	// ErrInvalidStage is returned when the Stage of a
+	// migration is not Major, Minor or Patch.
+	ErrInvalidStage = errors.New("invalid stage")
+	// ErrStageMismatch is returned by Validate when the
+	// Stage of a migration contradicts the version
+	// bump from the previous migration.
+	ErrStageMismatch = errors.New("stage does not match version")
+)
+
+// semverRegex matches versions in the form of
+// major.minor.patch with an optional v prefix,
+// pre-release and metadata.
+var semverRegex = regexp.MustCompile(`^v?\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// ValidationError is returned by Validate and contains
+// every problem found within the registry.
+type ValidationError struct {
+	Errors []error
+}
+
+// Error implements the error interface by joining the
+// problems found.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "invalid registry: " + strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the problems found match
+// the target, so errors.Is can be used with the
+// sentinel errors above.
+func (e *ValidationError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultRegistry is the registry used by AddMigration
+// and by Updaters with no Registry set in the
+// options.
+var defaultRegistry = NewRegistry()
+
+// NewRegistry returns a new empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{migrations: make(MigrationRegistry, 0)}
+}
+
+// Add adds a migration to the registry. The version and
+// Stage must be attached to the migration, and the
+// version must not have already been added. If
+// InferStage is set, the Stage may be left
+// empty to be filled by the registry.
+func (r *Registry) Add(m *Migration) error {
+	if m.Version == "" {
+		return errors.New("no version provided for update")
+	}
+
+	infer := m.Stage == "" && r.InferStage
+	if m.Stage == "" && !infer {
+		return errors.New("no stage set")
+	}
+
+	if !infer && !validStage(m.Stage) {
+		return fmt.Errorf("%w: %s", ErrInvalidStage, m.Stage)
+	}
+
+	if m.CallBackUp != nil && m.CallBackDown == nil {
+		return ErrCallBackMismatch
+	}
+
+	if m.CallBackUp == nil && m.CallBackDown != nil {
+		return ErrCallBackMismatch
+	}
+
+	ver, err := parseVersion(m.Version)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.find(ver) != nil {
+		return fmt.Errorf("%w: %s", ErrDuplicateVersion, m.Version)
+	}
+
+	r.migrations = append(r.migrations, m)
+
+	if infer {
+		if r.inferred == nil {
+			r.inferred = make(map[*Migration]Stage)
+		}
+		r.inferred[m] = ""
+	}
+	r.inferStages()
+
+	return nil
+}
+
+// inferStages stores the stages of the migrations added
+// without one, from the version bump from the
+// previous migration, or from v0.0.0 for the
+// first. Stages are recalculated as a
+// migration may be added between
+// others. The lock must be held
+// by the caller.
+func (r *Registry) inferStages() {
+	if len(r.inferred) == 0 {
+		return
+	}
+	all := make(MigrationRegistry, len(r.migrations))
+	copy(all, r.migrations)
+	sort.Sort(all)
+
+	prev := version.Must(version.NewVersion("v0.0.0"))
+	for _, m := range all {
+		ver := m.toSemVer()
+		if _, ok := r.inferred[m]; ok {
+			r.inferred[m] = stageBetween(prev, ver)
+		}
+		prev = ver
+	}
+}
+
+// Validate checks every migration in the registry and
+// returns a ValidationError listing malformed
+// versions, duplicates, invalid stages and
+// stages that contradict the version bump
+// from the previous migration.
+func (r *Registry) Validate() error {
+	r.mu.RLock()
+	all := make(MigrationRegistry, len(r.migrations))
+	copy(all, r.migrations)
+	stages := make(map[*Migration]Stage, len(all))
+	for _, m := range all {
+		stages[m] = r.stageOf(m)
+	}
+	r.mu.RUnlock()
+
+	var (
+		errs  []error
+		valid MigrationRegistry
+		seen  = make(map[string]string)
+	)
+
+	for _, m := range all {
+		ver, err := parseVersion(m.Version)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !validStage(stages[m]) {
+			errs = append(errs, fmt.Errorf("%w: %q for version %s", ErrInvalidStage, stages[m], m.Version))
+			continue
+		}
+		if original, ok := seen[ver.String()]; ok {
+			errs = append(errs, fmt.Errorf("%w: %s and %s", ErrDuplicateVersion, original, m.Version))
+			continue
+		}
+		seen[ver.String()] = m.Version
+		valid = append(valid, m)
+	}
+
+	sort.Sort(valid)
+	for i := 1; i < len(valid); i++ {
+		prev, m := valid[i-1], valid[i]
+		bump := stageBetween(prev.toSemVer(), m.toSemVer())
+		if bump != stages[m] {
+			errs = append(errs, fmt.Errorf("%w: %s is a %s release from %s but has the stage %s", ErrStageMismatch, m.Version, bump, prev.Version, stages[m]))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Errors: errs}
+}
+
+// Get retrieves a migration from the registry by looking
+// up the version. An error will be returned on failed
+// lookup.
+func (r *Registry) Get(version string) (*Migration, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, m := range r.migrations {
+		if m.Version == version {
+			return m, nil
+		}
+	}
+	return nil, errors.New("no migration found with the version: " + version)
+}
+
+// Stage returns the Stage of the migration passed, which
+// is inferred by the registry if the migration was
+// added without one and InferStage is set.
+func (r *Registry) Stage(m *Migration) Stage {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.stageOf(m)
+}
+
+// stageOf returns the Stage of the migration, see Stage.
+// The lock must be held by the caller.
+func (r *Registry) stageOf(m *Migration) Stage {
+	if stage, ok := r.inferred[m]; ok {
+		return stage
+	}
+	return m.Stage
+}
+
+// contains returns true if a migration with the version
+// passed has been added to the registry.
+func (r *Registry) contains(ver *version.Version) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.find(ver) != nil
+}
+
+// find returns the migration with the version passed, nil
+// is returned if there is none. The lock must be held
+// by the caller.
+func (r *Registry) find(ver *version.Version) *Migration {
+	for _, m := range r.migrations {
+		v, err := version.NewVersion(m.Version)
+		if err == nil && v.Equal(ver) {
+			return m
+		}
+	}
+	return nil
+}
+
+// All returns a copy of the migrations in the registry
+// sorted by version.
+func (r *Registry) All() MigrationRegistry {
+	r.mu.RLock()
+	all := make(MigrationRegistry, len(r.migrations))
+	copy(all, r.migrations)
+	r.mu.RUnlock()
+	sort.Sort(all)
+	return all
+}
+
+// registry returns the Registry set in the options, or
+// the default registry if there is none.
+func (u *Updater) registry() *Registry {
+	if u.opts.Registry == nil {
+		return defaultRegistry
+	}
+	return u.opts.Registry
+}
+
+// parseVersion parses the version of a migration, an
+// error wrapping ErrInvalidVersion is returned if it
+// is not in the form of major.minor.patch.
+func parseVersion(v string) (*version.Version, error) {
+	if !semverRegex.MatchString(v) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidVersion, v)
+	}
+	ver, err := version.NewVersion(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidVersion, err.Error())
+	}
+	return ver, nil
+}
+
+// validStage returns true if the stage is Major, Minor
+// or Patch.
+func validStage(s Stage) bool {
+	return s == Major || s == Minor || s == Patch
+}
+
+// StageBetween returns the Stage of the bump from one
+// version to another, for example v1.2.3 to v1.3.0
+// is Minor. An error wrapping ErrInvalidVersion
+// is returned if either version is malformed.
+func StageBetween(from, to string) (Stage, error) {
+	f, err := parseVersion(from)
+	if err != nil {
+		return "", err
+	}
+	t, err := parseVersion(to)
+	if err != nil {
+		return "", err
+	}
+	return stageBetween(f, t), nil
+}
+
+// ReleaseStage returns the Stage of the release version
+// relative to the currently running version, so
+// releases without any migrations can be
+// reported or checked against a Policy.
+func (u *Updater) ReleaseStage(release string) (Stage, error) {
+	ver, err := parseVersion(release)
+	if err != nil {
+		return "", err
+	}
+	return stageBetween(u.version, ver), nil
+}
+
+// stageBetween returns the stage of the bump from one
+// version to the next.
+func stageBetween(from, to *version.Version) Stage {
+	f, t := from.Segments(), to.Segments()
+	switch {
+	case f[0] != t[0]:
+		return Major
+	case f[1] != t[1]:
+		return Minor
+	}
+	return Patch
+}
@@ -0,0 +1,232 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+// testRegistry returns a Registry containing the migrations
+// passed without validating them.
+func testRegistry(ms MigrationRegistry) *Registry {
+	return &Registry{migrations: ms}
+}
+
+func TestRegistry_Concurrent(t *testing.T) {
+	r := NewRegistry()
+
+	var wg sync.WaitGroup
+	for i := 100; i > 0; i-- {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := r.Add(&Migration{Version: fmt.Sprintf("v0.0.%d", i), Stage: Patch})
+			assert.NoError(t, err)
+			_ = r.All()
+		}(i)
+	}
+	wg.Wait()
+
+	all := r.All()
+	assert.Len(t, all, 100)
+	assert.Equal(t, "v0.0.1", all[0].Version)
+	assert.Equal(t, "v0.0.100", all[99].Version)
+
+	got, err := r.Get("v0.0.50")
+	assert.NoError(t, err)
+	assert.Equal(t, "v0.0.50", got.Version)
+}
+
+func TestRegistry_Isolated(t *testing.T) {
+	a, b := NewRegistry(), NewRegistry()
+
+	assert.NoError(t, a.Add(&Migration{Version: "v0.0.1", Stage: Patch}))
+
+	_, err := b.Get("v0.0.1")
+	assert.Error(t, err)
+	assert.Empty(t, AllMigrations())
+
+	u := Updater{opts: Options{Registry: a}}
+	assert.Equal(t, a, u.registry())
+	assert.Equal(t, defaultRegistry, (&Updater{}).registry())
+}
+
+func TestRegistry_All(t *testing.T) {
+	r := testRegistry(MigrationRegistry{
+		&Migration{Version: "v0.0.2"},
+		&Migration{Version: "v0.0.1"},
+	})
+
+	all := r.All()
+	assert.Equal(t, "v0.0.1", all[0].Version)
+	assert.Equal(t, "v0.0.2", r.migrations[0].Version, "All should not sort the registry in place")
+}
+
+func TestRegistry_Add(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.Add(&Migration{Version: "v0.0.1", Stage: Patch}))
+
+	err := r.Add(&Migration{Version: "0.0.1", Stage: Patch})
+	assert.ErrorIs(t, err, ErrDuplicateVersion)
+
+	err = r.Add(&Migration{Version: "v1.3.3.3", Stage: Patch})
+	assert.ErrorIs(t, err, ErrInvalidVersion)
+
+	assert.Len(t, r.All(), 1)
+}
+
+func TestRegistry_Validate(t *testing.T) {
+	tt := map[string]struct {
+		input MigrationRegistry
+		want  []error
+	}{
+		"Valid": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", Stage: Patch},
+				&Migration{Version: "v0.1.0", Stage: Minor},
+				&Migration{Version: "v0.1.1", Stage: Patch},
+				&Migration{Version: "v1.0.0", Stage: Major},
+			},
+			nil,
+		},
+		"Bad Version": {
+			MigrationRegistry{
+				&Migration{Version: "wrong", Stage: Patch},
+				&Migration{Version: "v1.3.3.3", Stage: Patch},
+			},
+			[]error{ErrInvalidVersion},
+		},
+		"Duplicate": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", Stage: Patch},
+				&Migration{Version: "0.0.1", Stage: Patch},
+			},
+			[]error{ErrDuplicateVersion},
+		},
+		"Invalid Stage": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", Stage: "wrong"},
+			},
+			[]error{ErrInvalidStage},
+		},
+		"Stage Mismatch": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", Stage: Patch},
+				&Migration{Version: "v0.0.2", Stage: Major},
+				&Migration{Version: "v1.0.0", Stage: Minor},
+			},
+			[]error{ErrStageMismatch},
+		},
+		"Multiple": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", Stage: Patch},
+				&Migration{Version: "v0.0.1", Stage: Patch},
+				&Migration{Version: "wrong", Stage: Patch},
+				&Migration{Version: "v0.1.0", Stage: Patch},
+			},
+			[]error{ErrDuplicateVersion, ErrInvalidVersion, ErrStageMismatch},
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			err := testRegistry(test.input).Validate()
+			if test.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var verr *ValidationError
+			assert.ErrorAs(t, err, &verr)
+			for _, want := range test.want {
+				assert.ErrorIs(t, err, want)
+			}
+			assert.Contains(t, err.Error(), "invalid registry")
+		})
+	}
+}
+
+func TestStageBetween(t *testing.T) {
+	tt := map[string]struct {
+		from string
+		to   string
+		want Stage
+	}{
+		"Major": {"v1.2.3", "v2.0.0", Major},
+		"Minor": {"v1.2.3", "v1.3.0", Minor},
+		"Patch": {"v1.2.3", "v1.2.4", Patch},
+		"Same":  {"v1.2.3", "v1.2.3", Patch},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			got := stageBetween(version.Must(version.NewVersion(test.from)), version.Must(version.NewVersion(test.to)))
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestRegistry_InferStage(t *testing.T) {
+	r := &Registry{InferStage: true}
+
+	v1 := &Migration{Version: "v0.1.0"}
+	v3 := &Migration{Version: "v1.0.0"}
+	assert.NoError(t, r.Add(v1))
+	assert.NoError(t, r.Add(v3))
+	assert.EqualValues(t, Minor, r.Stage(v1))
+	assert.EqualValues(t, Major, r.Stage(v3))
+
+	v2 := &Migration{Version: "v0.1.1"}
+	assert.NoError(t, r.Add(v2))
+	assert.EqualValues(t, Patch, r.Stage(v2))
+	assert.EqualValues(t, Major, r.Stage(v3))
+	assert.Empty(t, v2.Stage, "Migrations added should not be modified")
+	assert.NoError(t, r.Validate())
+
+	set := &Migration{Version: "v1.0.1", Stage: Minor}
+	assert.NoError(t, r.Add(set))
+	assert.EqualValues(t, Minor, r.Stage(set), "Stages set explicitly should not be inferred")
+
+	assert.Error(t, r.Add(&Migration{Version: "v1.0.2", Stage: "wrong"}))
+	assert.Error(t, NewRegistry().Add(&Migration{Version: "v0.0.1"}))
+}
+
+func TestStageBetween_Exported(t *testing.T) {
+	tt := map[string]struct {
+		from string
+		to   string
+		want interface{}
+	}{
+		"Major":    {"v1.2.3", "2.0.0", Major},
+		"Minor":    {"1.2.3", "v1.3.0", Minor},
+		"Bad From": {"wrong", "v1.3.0", ErrInvalidVersion.Error()},
+		"Bad To":   {"v1.2.3", "wrong", ErrInvalidVersion.Error()},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			got, err := StageBetween(test.from, test.to)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.EqualValues(t, test.want, got)
+		})
+	}
+}
+
+func TestUpdater_ReleaseStage(t *testing.T) {
+	u := Updater{version: version.Must(version.NewVersion("v1.2.3"))}
+
+	got, err := u.ReleaseStage("v1.2.4")
+	assert.NoError(t, err)
+	assert.EqualValues(t, Patch, got)
+
+	_, err = u.ReleaseStage("wrong")
+	assert.ErrorIs(t, err, ErrInvalidVersion)
+}
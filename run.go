@@ -5,95 +5,227 @@
 package updater
 
 import (
-	"database/sql"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-version"
+	"io"
 	"io/ioutil"
+	"time"
 )
 
 // runMigrations sorts the migrations and loops over them.
 // If there is a migration to run it will be processed
-// and committed if the database exists.
-func (u *Updater) runMigrations() (Status, error) {
+// and committed if the database exists. Each migration
+// is recorded in the history table within the same
+// transaction as the migration itself. Migrations
+// newer than the target version are not run, the
+// from version is used as the starting point when
+// nothing has been recorded in the history.
+//
+// The migrations are run whilst holding the migration
+// lock so only one instance migrates at a time.
+func (u *Updater) runMigrations(ctx context.Context, from, target *version.Version) (Status, error) {
+	return u.withLock(ctx, func() (Status, error) {
+		return u.migrate(ctx, from, target)
+	})
+}
+
+// migrate processes the pending migrations using the
+// transaction mode of each migration, see
+// runMigrations.
+func (u *Updater) migrate(ctx context.Context, from, target *version.Version) (Status, error) {
 	var (
-		err error
-		tx  *sql.Tx
+		err     error
+		applied history
 	)
 
 	if u.opts.hasDB {
-		tx, err = u.opts.DB.Begin()
+		applied, err = u.history(ctx)
 		if err != nil {
 			return DatabaseError, err
 		}
-	}
 
-	migrations.Sort()
+		err = applied.checkDirty()
+		if err != nil {
+			return Dirty, err
+		}
 
-	var down []CallBackFn
-	for _, migration := range migrations {
-		shouldRun := u.version.LessThan(migration.toSemVer())
-		if !shouldRun {
-			continue
+		if u.opts.RefuseDrift {
+			err = applied.checkDrift(u.registry())
+			if errors.Is(err, ErrDrift) {
+				return Drifted, err
+			} else if err != nil {
+				return Unknown, err
+			}
 		}
+	}
 
-		code, err := u.process(migration, tx)
-		if err != nil {
-			rollBackErr := u.rollBack(tx, down)
-			if rollBackErr != nil {
-				// In a dirty state
-				return code, rollBackErr
+	b := u.newBatch(ctx, applied.start(from), target)
+	for _, migration := range pending(u.registry().All(), applied, from, target) {
+		start := time.Now()
+
+		code, err := b.run(migration, func(ex execer) (Status, error) {
+			code, err := u.process(b, migration, ex)
+			if err != nil || !u.opts.hasDB {
+				return code, err
+			}
+			err = u.record(ctx, ex, u.newRecord(migration, time.Since(start), true))
+			if err != nil {
+				return DatabaseError, err
 			}
-			return code, err
+			return code, nil
+		})
+
+		if err != nil {
+			return u.fail(b, u.newRecord(migration, time.Since(start), false), code, err)
 		}
+	}
 
-		down = append(down, migration.CallBackDown)
+	err = b.commit()
+	if err != nil {
+		// The migrations within the shared transaction have
+		// not been applied, the last is recorded as the
+		// failed migration.
+		last := b.uncommitted[len(b.uncommitted)-1]
+		return u.fail(b, u.newRecord(last, 0, false), DatabaseError, err)
+	}
+
+	return Updated, nil
+}
+
+// fail rolls back the batch after a migration failed and
+// records the failed attempt. If the migration was run
+// outside of a transaction, or the rollback failed,
+// the database is marked as dirty, Dirty is
+// returned and further updates are refused
+// until ForceVersion is called. The rollback is
+// not bound to the context, so it completes if
+// the context has been cancelled.
+func (u *Updater) fail(b *batch, record historyRecord, code Status, err error) (Status, error) {
+	if b.partial {
+		record.Dirty = true
+		code = Dirty
+	}
+
+	var rollBackErr error
+	if !b.partial {
+		rollBackErr = u.rollBack(b)
+		if rollBackErr != nil {
+			record.Dirty = true
+			code = Dirty
+		}
 	}
 
 	if u.opts.hasDB {
-		err := tx.Commit()
-		if err != nil {
-			return DatabaseError, err
+		// The failed attempt is recorded outside of the
+		// rolled back transaction, this is best effort
+		// and the original error takes precedence.
+		_ = u.record(context.Background(), u.opts.DB, record)
+	}
+
+	if rollBackErr != nil {
+		return code, rollBackErr
+	}
+
+	return code, err
+}
+
+// pending returns the sorted migrations that are yet to
+// be applied in the range of (current, target].
+// The current version is the highest version
+// recorded in the history. When there is no
+// database, or nothing has been recorded, the
+// from version is used instead.
+func pending(ms MigrationRegistry, h history, from, target *version.Version) MigrationRegistry {
+	current := h.start(from)
+
+	var pending MigrationRegistry
+	for _, migration := range ms {
+		semver := migration.toSemVer()
+		if !current.LessThan(semver) || semver.GreaterThan(target) {
+			continue
 		}
+		pending = append(pending, migration)
 	}
 
-	return Updated, nil
+	return pending
 }
 
 // rollback reverse the changes from the database (if
-// there is one) and the callbacks.
-func (u *Updater) rollBack(tx *sql.Tx, down []CallBackFn) error {
-	if u.opts.hasDB {
-		err := tx.Rollback()
+// there is one) and the callbacks of the processed
+// migrations in reverse order. SQL within the
+// shared transaction is reverted by rolling
+// it back, migrations that have already
+// been committed are reversed by
+// running their SQLDown and Down.
+func (u *Updater) rollBack(b *batch) error {
+	err := b.rollback()
+	if err != nil {
+		return err
+	}
+
+	for i := len(b.uncommitted) - 1; i >= 0; i-- {
+		m := b.uncommitted[i]
+		if !m.hasCallBack() {
+			continue
+		}
+		err := m.CallBackDown()
 		if err != nil {
 			return err
 		}
 	}
 
-	for _, fn := range down {
-		err := fn()
+	reversal := u.newBatch(context.Background(), b.to, b.from)
+	for i := len(b.committed) - 1; i >= 0; i-- {
+		m := b.committed[i]
+		if m.irreversible() {
+			_ = reversal.rollback()
+			return fmt.Errorf("%w: %s", ErrIrreversible, m.Version)
+		}
+		_, err := reversal.run(m, func(ex execer) (Status, error) {
+			return u.reverse(reversal, m, ex)
+		})
 		if err != nil {
+			_ = reversal.rollback()
 			return err
 		}
 	}
 
-	return nil
+	return reversal.commit()
 }
 
-// process reads the migration and executes the migration
-// if there is one. Calls the callback function if there
-// is one set.
-func (u *Updater) process(m *Migration, tx *sql.Tx) (Status, error) {
-	migration, err := ioutil.ReadAll(m.SQL)
+// process reads the migration and executes each of its
+// statements if there is one, followed by the Up
+// function. Calls the callback function if there
+// is one set and the context has not been
+// cancelled.
+func (u *Updater) process(b *batch, m *Migration, ex execer) (Status, error) {
+	ctx := b.ctx
+
+	migration, err := m.up()
 	if err != nil {
 		return Unknown, err
 	}
 
-	if u.opts.hasDB {
-		_, err = tx.Exec(string(migration))
+	if u.opts.hasDB && migration != "" {
+		err = execStatements(ctx, ex, u.dialect().Syntax(), m.Version, migration)
 		if err != nil {
 			return DatabaseError, err
 		}
 	}
 
+	if m.Up != nil {
+		err := m.Up(u.migrationContext(b, m, ex))
+		if err != nil {
+			return CallBackError, err
+		}
+	}
+
 	if m.hasCallBack() {
+		if ctx.Err() != nil {
+			return Unknown, ctx.Err()
+		}
 		err := m.CallBackUp()
 		if err != nil {
 			return CallBackError, err
@@ -102,3 +234,16 @@ func (u *Updater) process(m *Migration, tx *sql.Tx) (Status, error) {
 
 	return Updated, nil
 }
+
+// readSQL reads the SQL from the reader, an empty string
+// is returned if the reader is nil.
+func readSQL(r io.Reader) (string, error) {
+	if r == nil {
+		return "", nil
+	}
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
@@ -5,6 +5,7 @@
 package updater
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
@@ -19,6 +20,27 @@ const (
 	v002 = "UPDATE my_table SET name = 'nick' WHERE id = 2"
 )
 
+// expectHistory adds the expectations for creating and
+// retrieving the history table with the given rows.
+func expectHistory(m sqlmock.Sqlmock, versions ...string) {
+	m.ExpectExec("CREATE TABLE IF NOT EXISTS " + historyTable).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "success", "dirty", "checksum"})
+	for _, v := range versions {
+		rows.AddRow(v, true, false, "")
+	}
+	m.ExpectQuery("SELECT version, success, dirty, checksum FROM " + historyTable).
+		WillReturnRows(rows)
+}
+
+// expectRecord adds the expectation for inserting a
+// row into the history table.
+func expectRecord(m sqlmock.Sqlmock, version string, success bool) *sqlmock.ExpectedExec {
+	return m.ExpectExec("INSERT INTO "+historyTable).
+		WithArgs(version, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), success, false, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
 type errReader int
 
 func (errReader) Read(p []byte) (n int, err error) {
@@ -38,9 +60,11 @@ func TestUpdater_Run(t *testing.T) {
 				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Major},
 			},
 			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
 				m.ExpectBegin()
 				m.ExpectExec(v001).
 					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.1", true)
 				m.ExpectCommit()
 			},
 			true,
@@ -52,6 +76,7 @@ func TestUpdater_Run(t *testing.T) {
 				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Major},
 			},
 			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
 				m.ExpectBegin().
 					WillReturnError(fmt.Errorf("error"))
 			},
@@ -64,10 +89,12 @@ func TestUpdater_Run(t *testing.T) {
 				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Major},
 			},
 			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
 				m.ExpectBegin()
 				m.ExpectExec(v001).
 					WillReturnError(fmt.Errorf("error"))
 				m.ExpectRollback()
+				expectRecord(m, "v0.0.1", false)
 			},
 			true,
 			"error",
@@ -78,26 +105,33 @@ func TestUpdater_Run(t *testing.T) {
 				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Major},
 			},
 			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
 				m.ExpectBegin()
 				m.ExpectExec(v001).
 					WillReturnError(fmt.Errorf("error"))
 				m.ExpectRollback().
 					WillReturnError(fmt.Errorf("error"))
+				m.ExpectExec("INSERT INTO "+historyTable).
+					WithArgs("v0.0.1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), false, true, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 			true,
 			"error",
-			DatabaseError,
+			Dirty,
 		},
 		"Commit Error": {
 			MigrationRegistry{
 				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Major},
 			},
 			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
 				m.ExpectBegin()
 				m.ExpectExec(v001).
 					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.1", true)
 				m.ExpectCommit().
 					WillReturnError(fmt.Errorf("error"))
+				expectRecord(m, "v0.0.1", false)
 			},
 			true,
 			"error",
@@ -130,9 +164,11 @@ func TestUpdater_Run(t *testing.T) {
 				}},
 			},
 			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
 				m.ExpectBegin()
 				m.ExpectExec(v001).
 					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.1", true)
 				m.ExpectCommit()
 			},
 			true,
@@ -148,10 +184,12 @@ func TestUpdater_Run(t *testing.T) {
 				}},
 			},
 			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
 				m.ExpectBegin()
 				m.ExpectExec(v001).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				m.ExpectRollback()
+				expectRecord(m, "v0.0.1", false)
 			},
 			true,
 			"error",
@@ -171,16 +209,102 @@ func TestUpdater_Run(t *testing.T) {
 				}},
 			},
 			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
 				m.ExpectBegin()
 				m.ExpectExec(v001).
 					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.1", true)
 				m.ExpectExec(v002).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 				m.ExpectRollback()
 			},
 			true,
 			"callback error",
-			CallBackError,
+			Dirty,
+		},
+		"Rollback Without Callback": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Major},
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), Stage: Major},
+			},
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
+				m.ExpectBegin()
+				m.ExpectExec(v001).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.1", true)
+				m.ExpectExec(v002).
+					WillReturnError(fmt.Errorf("error"))
+				m.ExpectRollback()
+				expectRecord(m, "v0.0.2", false)
+			},
+			true,
+			"error",
+			DatabaseError,
+		},
+		"Above Target": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), Stage: Major},
+				&Migration{Version: "v0.0.5", SQL: strings.NewReader(v001), Stage: Major},
+			},
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
+				m.ExpectBegin()
+				m.ExpectExec(v002).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.2", true)
+				m.ExpectCommit()
+			},
+			true,
+			nil,
+			Updated,
+		},
+		"History Error": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Major},
+			},
+			func(m sqlmock.Sqlmock) {
+				m.ExpectExec("CREATE TABLE IF NOT EXISTS " + historyTable).
+					WillReturnError(fmt.Errorf("error"))
+			},
+			true,
+			"error",
+			DatabaseError,
+		},
+		"Already Applied": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Major},
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), Stage: Major},
+			},
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.1")
+				m.ExpectBegin()
+				m.ExpectExec(v002).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.2", true)
+				m.ExpectCommit()
+			},
+			true,
+			nil,
+			Updated,
+		},
+		"Record Error": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Major},
+			},
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
+				m.ExpectBegin()
+				m.ExpectExec(v001).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.1", true).
+					WillReturnError(fmt.Errorf("error"))
+				m.ExpectRollback()
+				expectRecord(m, "v0.0.1", false)
+			},
+			true,
+			"error",
+			DatabaseError,
 		},
 	}
 
@@ -195,10 +319,7 @@ func TestUpdater_Run(t *testing.T) {
 				test.mock(mock)
 			}
 
-			defer func() {
-				migrations = make(MigrationRegistry, 0)
-				db.Close()
-			}()
+			defer db.Close()
 
 			u := Updater{
 				opts: Options{
@@ -206,15 +327,15 @@ func TestUpdater_Run(t *testing.T) {
 					Version:   "0.0.0",
 					GithubURL: "https://github.com/ainsleyclark/verbis",
 					hasDB:     test.db,
+					Registry:  testRegistry(test.input),
 				},
 				pkg:     nil,
 				version: version.Must(version.NewVersion("0.0.0")),
 			}
 
-			migrations = test.input
 			assert.NoError(t, err)
 
-			code, err := u.runMigrations()
+			code, err := u.runMigrations(context.Background(), u.version, version.Must(version.NewVersion("0.0.2")))
 			assert.Equal(t, test.code, code)
 			if err != nil {
 				assert.Contains(t, err.Error(), test.want)
@@ -230,3 +351,294 @@ func TestUpdater_Run(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdater_RunTransactions(t *testing.T) {
+	tt := map[string]struct {
+		input MigrationRegistry
+		mock  func(m sqlmock.Sqlmock)
+		want  interface{}
+		code  Status
+	}{
+		"Own": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Patch},
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), Stage: Patch, Transaction: TxOwn},
+			},
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
+				m.ExpectBegin()
+				m.ExpectExec(v001).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.1", true)
+				m.ExpectCommit()
+				m.ExpectBegin()
+				m.ExpectExec(v002).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.2", true)
+				m.ExpectCommit()
+			},
+			nil,
+			Updated,
+		},
+		"None": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Patch, Transaction: TxNone},
+			},
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
+				m.ExpectExec(v001).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.1", true)
+			},
+			nil,
+			Updated,
+		},
+		"None Error": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Patch, Transaction: TxNone},
+			},
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
+				m.ExpectExec(v001).WillReturnError(fmt.Errorf("error"))
+				m.ExpectExec("INSERT INTO "+historyTable).
+					WithArgs("v0.0.1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), false, true, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			"error",
+			Dirty,
+		},
+		"Committed Reversed": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), SQLDown: strings.NewReader(v001Down), Stage: Patch, Transaction: TxOwn},
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), Stage: Patch},
+			},
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
+				m.ExpectBegin()
+				m.ExpectExec(v001).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.1", true)
+				m.ExpectCommit()
+				m.ExpectBegin()
+				m.ExpectExec(v002).WillReturnError(fmt.Errorf("error"))
+				m.ExpectRollback()
+				m.ExpectBegin()
+				m.ExpectExec(v001Down).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectForget(m, "v0.0.1")
+				m.ExpectCommit()
+				expectRecord(m, "v0.0.2", false)
+			},
+			"error",
+			DatabaseError,
+		},
+		"Final Commit Error": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), SQLDown: strings.NewReader(v001Down), Stage: Patch, Transaction: TxOwn},
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), Stage: Patch},
+			},
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
+				m.ExpectBegin()
+				m.ExpectExec(v001).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.1", true)
+				m.ExpectCommit()
+				m.ExpectBegin()
+				m.ExpectExec(v002).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.2", true)
+				m.ExpectCommit().WillReturnError(fmt.Errorf("error"))
+				m.ExpectBegin()
+				m.ExpectExec(v001Down).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectForget(m, "v0.0.1")
+				m.ExpectCommit()
+				expectRecord(m, "v0.0.2", false)
+			},
+			"error",
+			DatabaseError,
+		},
+		"Committed Irreversible": {
+			MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Patch, Transaction: TxOwn},
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), Stage: Patch},
+			},
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
+				m.ExpectBegin()
+				m.ExpectExec(v001).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.1", true)
+				m.ExpectCommit()
+				m.ExpectBegin()
+				m.ExpectExec(v002).WillReturnError(fmt.Errorf("error"))
+				m.ExpectRollback()
+				m.ExpectExec("INSERT INTO "+historyTable).
+					WithArgs("v0.0.2", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), false, true, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			ErrIrreversible.Error(),
+			Dirty,
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			test.mock(mock)
+
+			registry := testRegistry(test.input)
+
+			u := Updater{
+				opts:    Options{DB: db, hasDB: true, Registry: registry},
+				version: version.Must(version.NewVersion("0.0.0")),
+			}
+
+			code, err := u.runMigrations(context.Background(), u.version, version.Must(version.NewVersion("0.0.2")))
+			assert.Equal(t, test.code, code)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+			} else {
+				assert.Nil(t, test.want)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdater_RunCancelled(t *testing.T) {
+	called := false
+	callback := func() error {
+		called = true
+		return nil
+	}
+
+	registry := testRegistry(MigrationRegistry{
+		&Migration{Version: "v0.0.1", Stage: Patch, CallBackUp: callback, CallBackDown: callback},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	u := Updater{
+		opts:    Options{Registry: registry},
+		version: version.Must(version.NewVersion("0.0.0")),
+	}
+
+	code, err := u.runMigrations(ctx, u.version, version.Must(version.NewVersion("0.0.1")))
+	assert.Equal(t, Status(Unknown), code)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.False(t, called)
+}
+
+func TestUpdater_RunMySQL(t *testing.T) {
+	tt := map[string]struct {
+		mock func(m sqlmock.Sqlmock)
+		want interface{}
+		code Status
+	}{
+		"Success": {
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
+				m.ExpectBegin()
+				m.ExpectExec(v001).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.1", true)
+				m.ExpectCommit()
+				m.ExpectBegin()
+				m.ExpectExec(v002).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.2", true)
+				m.ExpectCommit()
+			},
+			nil,
+			Updated,
+		},
+		"Error": {
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
+				m.ExpectBegin()
+				m.ExpectExec(v001).WillReturnResult(sqlmock.NewResult(1, 1))
+				expectRecord(m, "v0.0.1", true)
+				m.ExpectCommit()
+				m.ExpectBegin()
+				m.ExpectExec(v002).WillReturnError(fmt.Errorf("error"))
+				m.ExpectRollback()
+				m.ExpectExec("INSERT INTO "+historyTable).
+					WithArgs("v0.0.2", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), false, true, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			"error",
+			Dirty,
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			mock.ExpectQuery("SELECT GET_LOCK").
+				WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+			test.mock(mock)
+			mock.ExpectExec("SELECT RELEASE_LOCK").
+				WillReturnResult(sqlmock.NewResult(0, 0))
+
+			registry := testRegistry(MigrationRegistry{
+				&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), Stage: Patch},
+				&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), Stage: Patch},
+			})
+
+			u := Updater{
+				opts:    Options{DB: db, hasDB: true, Registry: registry, Dialect: MySQL},
+				version: version.Must(version.NewVersion("0.0.0")),
+			}
+
+			code, err := u.runMigrations(context.Background(), u.version, version.Must(version.NewVersion("0.0.2")))
+			assert.Equal(t, test.code, code)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+			} else {
+				assert.Nil(t, test.want)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdater_RunFinalCommitCallBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	called := false
+	callback := func() error {
+		called = true
+		return nil
+	}
+
+	registry := testRegistry(MigrationRegistry{
+		&Migration{Version: "v0.0.1", SQL: strings.NewReader(v001), SQLDown: strings.NewReader(v001Down), Stage: Patch, Transaction: TxOwn},
+		&Migration{Version: "v0.0.2", SQL: strings.NewReader(v002), Stage: Patch, CallBackUp: func() error { return nil }, CallBackDown: callback},
+	})
+
+	expectHistory(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec(v001).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectRecord(mock, "v0.0.1", true)
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(v002).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectRecord(mock, "v0.0.2", true)
+	mock.ExpectCommit().WillReturnError(fmt.Errorf("commit error"))
+	mock.ExpectBegin()
+	mock.ExpectExec(v001Down).WillReturnResult(sqlmock.NewResult(1, 1))
+	expectForget(mock, "v0.0.1")
+	mock.ExpectCommit()
+	expectRecord(mock, "v0.0.2", false)
+
+	u := Updater{
+		opts:    Options{DB: db, hasDB: true, Registry: registry},
+		version: version.Must(version.NewVersion("0.0.0")),
+	}
+
+	code, err := u.migrate(context.Background(), u.version, version.Must(version.NewVersion("0.0.2")))
+	assert.Equal(t, Status(DatabaseError), code)
+	assert.EqualError(t, err, "commit error")
+	assert.True(t, called)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,354 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package server serves the releases within a directory
+// of archives, along with a generated manifest that is
+// read by updater.ManifestSource.
+package server
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ainsleyclark/updater"
+	"github.com/hashicorp/go-version"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultManifestPath is the path the manifest is served
+// from when none is set in the options.
+const DefaultManifestPath = "/releases.json"
+
+// Options define the arguments parsed to the Server.
+type Options struct {
+	// The directory containing the release archives. The
+	// version of an archive is taken from its file name,
+	// such as "my-repo_v0.0.2_linux_amd64.zip", along
+	// with the OS and architecture if they follow
+	// the version, see updater.ParseArchiveName.
+	//
+	// The notes, date and mandatory flag of a release
+	// can be set with a JSON file named by version,
+	// such as "v0.0.2.json", otherwise the date is
+	// the latest modification time of its
+	// archives.
+	Dir string
+	// The path the manifest is served from, defaults to
+	// DefaultManifestPath. The signature is served
+	// from the path with ".sig" appended.
+	ManifestPath string
+	// The key used to sign the manifest, the manifest is
+	// not signed if nil.
+	PrivateKey ed25519.PrivateKey
+}
+
+// Server is a http.Handler serving the manifest and the
+// archives within the directory. Archives are served
+// with support for Range requests and ETags, and
+// the directory is scanned on each request for
+// the manifest, so new releases are served
+// as soon as they are copied in.
+type Server struct {
+	opts  Options
+	mu    sync.Mutex
+	sums  map[string]checksum
+	files map[string]string
+}
+
+// checksum is the cached SHA-256 checksum of an archive,
+// invalidated when the archive changes.
+type checksum struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+var (
+	// ErrDir is returned by New when the directory of the
+	// options is not a directory.
+	ErrDir = errors.New("invalid release directory")
+	// ErrPrivateKey is returned by New when the private key
+	// of the options is not a valid ed25519 key.
+	ErrPrivateKey = errors.New("invalid private key")
+)
+
+// New returns a new Server with the options passed. If
+// validation failed on the options an error will be
+// returned.
+func New(opts Options) (*Server, error) {
+	info, err := os.Stat(opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDir, err.Error())
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%w: %s is not a directory", ErrDir, opts.Dir)
+	}
+
+	if opts.PrivateKey != nil && len(opts.PrivateKey) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("%w: must be %d bytes", ErrPrivateKey, ed25519.PrivateKeySize)
+	}
+
+	if opts.ManifestPath == "" {
+		opts.ManifestPath = DefaultManifestPath
+	}
+
+	if !strings.HasPrefix(opts.ManifestPath, "/") {
+		opts.ManifestPath = "/" + opts.ManifestPath
+	}
+
+	s := &Server{
+		opts:  opts,
+		sums:  make(map[string]checksum),
+		files: make(map[string]string),
+	}
+
+	return s, nil
+}
+
+// ServeHTTP serves the manifest, its signature or an
+// archive depending on the path requested.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch r.URL.Path {
+	case s.opts.ManifestPath:
+		s.serveManifest(w, r, false)
+	case s.opts.ManifestPath + ".sig":
+		if s.opts.PrivateKey == nil {
+			http.NotFound(w, r)
+			return
+		}
+		s.serveManifest(w, r, true)
+	default:
+		s.serveArchive(w, r)
+	}
+}
+
+// serveManifest generates and serves the manifest, or its
+// signature.
+func (s *Server) serveManifest(w http.ResponseWriter, r *http.Request, signature bool) {
+	manifest, err := s.Manifest()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	buf, err := json.Marshal(manifest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if signature {
+		buf = []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(s.opts.PrivateKey, buf)))
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+
+	sum := sha256.Sum256(buf)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf))
+}
+
+// serveArchive serves an archive found by the last scan
+// of the directory, with the checksum as the ETag.
+func (s *Server) serveArchive(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+
+	s.mu.Lock()
+	file, ok := s.files[name]
+	s.mu.Unlock()
+
+	if !ok {
+		_, err := s.Manifest()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.mu.Lock()
+		file, ok = s.files[name]
+		s.mu.Unlock()
+	}
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sum, err := s.checksum(file, info)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", `"`+sum+`"`)
+	w.Header().Set("Content-Type", "application/octet-stream")
+
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// Manifest scans the directory and returns the manifest
+// of the archives within it, newest first. Asset URLs
+// are relative to the manifest.
+func (s *Server) Manifest() (*updater.Manifest, error) {
+	entries, err := ioutil.ReadDir(s.opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		releases = make(map[string]*updater.ManifestRelease)
+		dated    = make(map[string]bool)
+		files    = make(map[string]string)
+	)
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasSuffix(name, ".json") || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		info, ok := updater.ParseArchiveName(name)
+		if !ok {
+			continue
+		}
+		ver := info.Version
+
+		file := filepath.Join(s.opts.Dir, name)
+		sum, err := s.checksum(file, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		key := ver.String()
+		release, ok := releases[key]
+		if !ok {
+			release, err = s.release(ver.Original())
+			if err != nil {
+				return nil, err
+			}
+			releases[key] = release
+			dated[key] = !release.Date.IsZero()
+		}
+
+		if !dated[key] && entry.ModTime().After(release.Date) {
+			release.Date = entry.ModTime().UTC()
+		}
+
+		release.Assets = append(release.Assets, updater.ManifestAsset{
+			Name:   name,
+			OS:     info.OS,
+			Arch:   info.Arch,
+			URL:    url.PathEscape(name),
+			SHA256: sum,
+			Size:   entry.Size(),
+		})
+		files[name] = file
+	}
+
+	manifest := &updater.Manifest{Releases: make([]updater.ManifestRelease, 0, len(releases))}
+	for _, release := range releases {
+		manifest.Releases = append(manifest.Releases, *release)
+	}
+
+	sort.Slice(manifest.Releases, func(i, j int) bool {
+		a, _ := version.NewVersion(manifest.Releases[i].Version)
+		b, _ := version.NewVersion(manifest.Releases[j].Version)
+		return a.GreaterThan(b)
+	})
+
+	s.mu.Lock()
+	s.files = files
+	s.mu.Unlock()
+
+	return manifest, nil
+}
+
+// release returns the release of the version, read from
+// the JSON file named by the version if there is one.
+func (s *Server) release(v string) (*updater.ManifestRelease, error) {
+	release := &updater.ManifestRelease{}
+
+	buf, err := ioutil.ReadFile(filepath.Join(s.opts.Dir, v+".json"))
+	if err == nil {
+		err = json.Unmarshal(buf, release)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s.json: %s", v, err.Error())
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	release.Version = v
+	release.Assets = nil
+
+	return release, nil
+}
+
+// checksum returns the hex encoded SHA-256 checksum of the
+// archive, which is cached until the size or
+// modification time of the file changes.
+func (s *Server) checksum(file string, info os.FileInfo) (string, error) {
+	s.mu.Lock()
+	cached, ok := s.sums[file]
+	s.mu.Unlock()
+
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.sum, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	s.mu.Lock()
+	s.sums[file] = checksum{size: info.Size(), modTime: info.ModTime(), sum: sum}
+	s.mu.Unlock()
+
+	return sum, nil
+}
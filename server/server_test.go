@@ -0,0 +1,294 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/ainsleyclark/updater"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testDir writes the files passed to a temporary
+// directory and returns its path.
+func testDir(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), os.ModePerm))
+	}
+	return dir
+}
+
+// sha256Of returns the hex encoded SHA-256 checksum of
+// the string passed.
+func sha256Of(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestNew(t *testing.T) {
+	dir := testDir(t, map[string]string{"file": "file"})
+
+	tt := map[string]struct {
+		input Options
+		want  interface{}
+	}{
+		"Success": {
+			Options{Dir: dir},
+			DefaultManifestPath,
+		},
+		"Manifest Path": {
+			Options{Dir: dir, ManifestPath: "updates.json"},
+			"/updates.json",
+		},
+		"No Directory": {
+			Options{Dir: filepath.Join(dir, "wrong")},
+			ErrDir.Error(),
+		},
+		"Private Key": {
+			Options{Dir: dir, PrivateKey: ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))},
+			DefaultManifestPath,
+		},
+		"Short Private Key": {
+			Options{Dir: dir, PrivateKey: ed25519.PrivateKey("short")},
+			ErrPrivateKey.Error(),
+		},
+		"Not A Directory": {
+			Options{Dir: filepath.Join(dir, "file")},
+			"is not a directory",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			got, err := New(test.input)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.Equal(t, test.want, got.opts.ManifestPath)
+		})
+	}
+}
+
+func TestServer_Manifest(t *testing.T) {
+	dir := testDir(t, map[string]string{
+		"verbis_v0.0.1_linux_amd64.zip":  "1",
+		"verbis_v0.0.10_linux_amd64.zip": "10",
+		"verbis_v0.0.2_linux_amd64.zip":  "2-linux",
+		"verbis_v0.0.2_darwin_arm64.zip": "2-darwin",
+		"v0.0.2.json":                    `{"notes": "Security fix", "mandatory": true, "date": "2021-06-01T00:00:00Z"}`,
+		"README.md":                      "readme",
+		".hidden_v0.0.3.zip":             "hidden",
+	})
+
+	s, err := New(Options{Dir: dir})
+	assert.NoError(t, err)
+
+	got, err := s.Manifest()
+	assert.NoError(t, err)
+
+	var versions []string
+	for _, r := range got.Releases {
+		versions = append(versions, r.Version)
+	}
+	assert.Equal(t, []string{"v0.0.10", "v0.0.2", "v0.0.1"}, versions)
+
+	release := got.Releases[1]
+	assert.True(t, release.Mandatory)
+	assert.Equal(t, "Security fix", release.Notes)
+	assert.Equal(t, "2021-06-01T00:00:00Z", release.Date.Format("2006-01-02T15:04:05Z07:00"))
+	assert.Equal(t, &updater.ManifestAsset{
+		Name:   "verbis_v0.0.2_darwin_arm64.zip",
+		OS:     "darwin",
+		Arch:   "arm64",
+		URL:    "verbis_v0.0.2_darwin_arm64.zip",
+		SHA256: sha256Of("2-darwin"),
+		Size:   8,
+	}, release.Asset("darwin", "arm64"))
+	assert.False(t, got.Releases[0].Date.IsZero())
+}
+
+func TestServer_ManifestDashes(t *testing.T) {
+	dir := testDir(t, map[string]string{
+		"app-v1.2.3-linux-amd64.tar.gz":      "3",
+		"app-v1.2.4-rc.1-linux-amd64.tar.gz": "4",
+	})
+
+	s, err := New(Options{Dir: dir})
+	assert.NoError(t, err)
+
+	got, err := s.Manifest()
+	assert.NoError(t, err)
+	assert.Len(t, got.Releases, 2)
+
+	assert.Equal(t, "v1.2.4-rc.1", got.Releases[0].Version)
+	assert.Equal(t, "v1.2.3", got.Releases[1].Version)
+	asset := got.Releases[1].Asset("linux", "amd64")
+	assert.NotNil(t, asset)
+	assert.Equal(t, "app-v1.2.3-linux-amd64.tar.gz", asset.Name)
+}
+
+func TestServer_ManifestBadRelease(t *testing.T) {
+	dir := testDir(t, map[string]string{
+		"verbis_v0.0.1.zip": "1",
+		"v0.0.1.json":       "wrong",
+	})
+
+	s, err := New(Options{Dir: dir})
+	assert.NoError(t, err)
+
+	_, err = s.Manifest()
+	assert.Contains(t, err.Error(), "error reading v0.0.1.json")
+}
+
+func TestServer_ServeHTTP(t *testing.T) {
+	dir := testDir(t, map[string]string{
+		"verbis_v0.0.1.zip": "0123456789",
+	})
+
+	s, err := New(Options{Dir: dir})
+	assert.NoError(t, err)
+
+	manifest := httptest.NewRecorder()
+	s.ServeHTTP(manifest, httptest.NewRequest(http.MethodGet, DefaultManifestPath, nil))
+	assert.Equal(t, http.StatusOK, manifest.Code)
+	assert.Equal(t, "application/json", manifest.Header().Get("Content-Type"))
+
+	tt := map[string]struct {
+		method string
+		path   string
+		header map[string]string
+		status int
+		want   string
+	}{
+		"Archive": {
+			http.MethodGet,
+			"/verbis_v0.0.1.zip",
+			nil,
+			http.StatusOK,
+			"0123456789",
+		},
+		"Range": {
+			http.MethodGet,
+			"/verbis_v0.0.1.zip",
+			map[string]string{"Range": "bytes=2-5"},
+			http.StatusPartialContent,
+			"2345",
+		},
+		"Archive Not Modified": {
+			http.MethodGet,
+			"/verbis_v0.0.1.zip",
+			map[string]string{"If-None-Match": `"` + sha256Of("0123456789") + `"`},
+			http.StatusNotModified,
+			"",
+		},
+		"Manifest Not Modified": {
+			http.MethodGet,
+			DefaultManifestPath,
+			map[string]string{"If-None-Match": manifest.Header().Get("ETag")},
+			http.StatusNotModified,
+			"",
+		},
+		"Head": {
+			http.MethodHead,
+			"/verbis_v0.0.1.zip",
+			nil,
+			http.StatusOK,
+			"",
+		},
+		"Not Found": {
+			http.MethodGet,
+			"/wrong.zip",
+			nil,
+			http.StatusNotFound,
+			"404 page not found\n",
+		},
+		"Traversal": {
+			http.MethodGet,
+			"/../verbis_v0.0.1.zip/..",
+			nil,
+			http.StatusNotFound,
+			"404 page not found\n",
+		},
+		"No Signature": {
+			http.MethodGet,
+			DefaultManifestPath + ".sig",
+			nil,
+			http.StatusNotFound,
+			"404 page not found\n",
+		},
+		"Method": {
+			http.MethodPost,
+			DefaultManifestPath,
+			nil,
+			http.StatusMethodNotAllowed,
+			"Method Not Allowed\n",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, nil)
+			for k, v := range test.header {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, req)
+			assert.Equal(t, test.status, rr.Code)
+			assert.Equal(t, test.want, rr.Body.String())
+		})
+	}
+}
+
+func TestServer_ManifestSource(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	dir := testDir(t, map[string]string{
+		"verbis_v0.0.1.zip": "1",
+		"verbis_v0.0.2.zip": "2",
+		"v0.0.2.json":       `{"notes": "Security fix"}`,
+	})
+
+	s, err := New(Options{Dir: dir, ManifestPath: "/updates/releases.json", PrivateKey: private})
+	assert.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.Handle("/updates/", s)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	source := &updater.ManifestSource{URL: ts.URL + "/updates/releases.json", PublicKey: public}
+
+	latest, err := source.LatestVersion(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "v0.0.2", latest)
+
+	release, err := source.Release(context.Background(), latest)
+	assert.NoError(t, err)
+	assert.Equal(t, "Security fix", release.Notes)
+
+	rc, err := source.Open(context.Background(), latest, "verbis_v0.0.2.zip")
+	assert.NoError(t, err)
+	defer rc.Close()
+	got, err := ioutil.ReadAll(rc)
+	assert.NoError(t, err)
+	assert.Equal(t, "2", string(got))
+
+	other, _, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	source.PublicKey = other
+	_, err = source.LatestVersion(context.Background())
+	assert.ErrorIs(t, err, updater.ErrSignature)
+}
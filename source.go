@@ -0,0 +1,212 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mouuff/go-rocket-update/pkg/provider"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// Source retrieves the releases of the executable, such
+// as the GitHub releases of a repository. GitHub is
+// used when no Source is set in the options.
+type Source interface {
+	// Releases returns the versions of every release
+	// available, newest first.
+	Releases(ctx context.Context) ([]string, error)
+	// LatestVersion returns the version of the newest
+	// release.
+	LatestVersion(ctx context.Context) (string, error)
+	// Open returns the archive of the release with the
+	// name passed, such as
+	// "my-repo_v0.0.1_linux_amd64.zip". The
+	// reader is closed by the caller.
+	Open(ctx context.Context, version, archive string) (io.ReadCloser, error)
+}
+
+var (
+	// ErrNoRelease is returned by a Source when there is no
+	// archive for the version or name requested.
+	ErrNoRelease = errors.New("release not found")
+)
+
+// URLSource is implemented by sources that can return
+// the location of a release archive without opening
+// it, the URL is reported by Plan.
+type URLSource interface {
+	Source
+	// URL returns the location of the archive of the
+	// release.
+	URL(version, archive string) (string, error)
+}
+
+// source returns the Source set in the options, or the
+// GitHub repository of the GithubURL if there is
+// none.
+func (u *Updater) source() Source {
+	if u.opts.Source != nil {
+		return u.opts.Source
+	}
+	return &GithubSource{RepositoryURL: u.opts.GithubURL}
+}
+
+// sourceGet sends a GET request with the headers passed
+// and returns the response. An error is returned if
+// the status is not 200 OK. The default client is
+// used if the client is nil.
+func sourceGet(ctx context.Context, client *http.Client, url string, header http.Header) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error requesting %s: %s", url, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// sourceGetJSON sends a GET request with the headers
+// passed and decodes the JSON response into v.
+func sourceGetJSON(ctx context.Context, client *http.Client, url string, header http.Header, v interface{}) error {
+	resp, err := sourceGet(ctx, client, url, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// sameHost returns true if both URLs have the same host,
+// so tokens are not sent to asset links hosted
+// elsewhere.
+func sameHost(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return ua.Host == ub.Host
+}
+
+// sourceRelease is a provider.Provider that installs the
+// archive of a specific release from a Source, rather
+// than the latest release.
+type sourceRelease struct {
+	source  Source
+	archive string
+	version string
+
+	ctx        context.Context   // context of the download, background if nil
+	tmpDir     string            // temporary directory the archive is copied to
+	decompress provider.Provider // provider used to decompress the archive
+}
+
+// Open copies the release archive to a temporary
+// directory and opens it for decompression. The
+// directory is removed if opening fails, as
+// Close is only called after Open
+// succeeds.
+func (s *sourceRelease) Open() error {
+	err := s.open()
+	if err != nil {
+		_ = s.Close()
+	}
+	return err
+}
+
+// open copies and opens the archive, see Open.
+func (s *sourceRelease) open() error {
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	rc, err := s.source.Open(ctx, s.version, s.archive)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	s.tmpDir, err = ioutil.TempDir("", "updater")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.tmpDir, filepath.Base(s.archive))
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, rc)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	s.decompress, err = provider.Decompress(path)
+	if err != nil {
+		return err
+	}
+
+	return s.decompress.Open()
+}
+
+// Close closes the decompression provider and removes
+// the temporary directory.
+func (s *sourceRelease) Close() error {
+	if s.decompress != nil {
+		_ = s.decompress.Close()
+		s.decompress = nil
+	}
+	if s.tmpDir != "" {
+		_ = os.RemoveAll(s.tmpDir)
+		s.tmpDir = ""
+	}
+	return nil
+}
+
+// GetLatestVersion returns the version of the release,
+// so the updater treats it as the version to install.
+func (s *sourceRelease) GetLatestVersion() (string, error) {
+	return s.version, nil
+}
+
+// Walk walks all the files within the archive.
+func (s *sourceRelease) Walk(walkFn provider.WalkFunc) error {
+	return s.decompress.Walk(walkFn)
+}
+
+// Retrieve copies a file within the archive to the
+// destination path.
+func (s *sourceRelease) Retrieve(src, dest string) error {
+	return s.decompress.Retrieve(src, dest)
+}
@@ -0,0 +1,66 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"github.com/hashicorp/go-version"
+	"github.com/mouuff/go-rocket-update/pkg/updater"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdater_Source(t *testing.T) {
+	u := Updater{opts: Options{GithubURL: "https://github.com/ainsleyclark/verbis"}}
+	assert.Equal(t, &GithubSource{RepositoryURL: "https://github.com/ainsleyclark/verbis"}, u.source())
+
+	source := &mockSource{}
+	u = Updater{opts: Options{Source: source}}
+	assert.Equal(t, source, u.source())
+}
+
+func TestUpdater_UpdateSource(t *testing.T) {
+	tt := map[string]struct {
+		input Source
+		want  interface{}
+		code  Status
+	}{
+		"Success": {
+			&mockSource{archive: testArchive(t, map[string]string{"verbis": "new"})},
+			"new",
+			Updated,
+		},
+		"Error": {
+			&mockSourceErr{},
+			"error",
+			ExecutableError,
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			exec := filepath.Join(t.TempDir(), "verbis")
+			assert.NoError(t, ioutil.WriteFile(exec, []byte("old"), os.ModePerm))
+
+			u := Updater{
+				opts:    Options{Version: "v0.0.0", Source: test.input, Registry: NewRegistry()},
+				pkg:     &updater.Updater{OverrideExecutable: exec},
+				version: version.Must(version.NewVersion("v0.0.0")),
+			}
+
+			code, err := u.Update("verbis.zip")
+			assert.Equal(t, test.code, code)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			got, err := ioutil.ReadFile(exec)
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,313 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// statement represents a singular SQL statement that has
+// been split from a migration.
+type statement struct {
+	// The SQL of the statement without the delimiter.
+	SQL string
+	// The line number the statement starts on within
+	// the migration.
+	Line int
+}
+
+// Syntax defines the syntax that is understood when
+// splitting statements, as it differs between dialects.
+type Syntax struct {
+	// Backslashes escape characters within quotes.
+	BackslashEscapes bool
+	// Dollar quoted strings such as $$ or $tag$ are
+	// treated as a single string.
+	DollarQuotes bool
+	// Lines beginning with # are treated as comments.
+	HashComments bool
+	// DELIMITER directives change the statement delimiter.
+	Delimiters bool
+	// The BEGIN ... END body of CREATE TRIGGER statements
+	// is kept within a single statement.
+	Triggers bool
+}
+
+// defaultSyntax is the syntax used when there is no
+// dialect to determine it from.
+var defaultSyntax = Syntax{
+	BackslashEscapes: true,
+	DollarQuotes:     true,
+	HashComments:     false,
+	Delimiters:       true,
+}
+
+// StatementError is the error returned when a statement
+// within a migration failed to execute.
+type StatementError struct {
+	// The version of the migration.
+	Version string
+	// The index of the statement within the migration,
+	// starting at one.
+	Index int
+	// The line the statement starts on within the
+	// migration.
+	Line int
+	// The error returned by the database.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *StatementError) Error() string {
+	return fmt.Sprintf("migration %s: statement %d on line %d: %s", e.Version, e.Index, e.Line, e.Err.Error())
+}
+
+// Unwrap returns the error returned by the database.
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// execStatements splits the query into statements and
+// executes them one by one.
+// A StatementError is returned on failure.
+func execStatements(ctx context.Context, ex execer, syntax Syntax, version, query string) error {
+	for i, stmt := range splitStatements(query, syntax) {
+		_, err := ex.ExecContext(ctx, stmt.SQL)
+		if err != nil {
+			return &StatementError{
+				Version: version,
+				Index:   i + 1,
+				Line:    stmt.Line,
+				Err:     err,
+			}
+		}
+	}
+	return nil
+}
+
+// splitStatements splits the SQL passed into singular
+// statements. Delimiters within quotes, comments,
+// dollar quoted strings and trigger bodies are
+// ignored. Statements that only contain
+// comments are discarded.
+func splitStatements(query string, syntax Syntax) []statement {
+	var (
+		stmts     []statement
+		buf       strings.Builder
+		delimiter = ";"
+		line      = 1
+		start     = 0
+		content   = false
+		words     []string
+		trigger   = false
+		depth     = 0
+	)
+
+	flush := func() {
+		if content {
+			stmts = append(stmts, statement{
+				SQL:  strings.TrimSpace(buf.String()),
+				Line: start,
+			})
+		}
+		buf.Reset()
+		content = false
+		words = words[:0]
+		trigger = false
+		depth = 0
+	}
+
+	// mark records the start of the statement when the
+	// first character outside of a comment is found.
+	mark := func() {
+		if !content {
+			content = true
+			start = line
+		}
+	}
+
+	for i := 0; i < len(query); {
+		c := query[i]
+
+		// DELIMITER directives are only valid at the start
+		// of a line before a statement has begun.
+		if syntax.Delimiters && !content && atLineStart(query, i) && hasPrefixFold(query[i:], "DELIMITER ") {
+			end := strings.IndexByte(query[i:], '\n')
+			if end == -1 {
+				end = len(query) - i
+			}
+			if d := strings.TrimSpace(query[i+len("DELIMITER ") : i+end]); d != "" {
+				delimiter = d
+			}
+			buf.Reset()
+			i += end
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(query[i:], delimiter) && depth == 0:
+			flush()
+			i += len(delimiter)
+			continue
+		case c == '\n':
+			line++
+		case c == '-' && strings.HasPrefix(query[i:], "--"),
+			c == '#' && syntax.HashComments:
+			end := strings.IndexByte(query[i:], '\n')
+			if end == -1 {
+				end = len(query) - i
+			}
+			buf.WriteString(query[i : i+end])
+			i += end
+			continue
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end == -1 {
+				end = len(query) - i
+			} else {
+				end += 4
+			}
+			line += strings.Count(query[i:i+end], "\n")
+			buf.WriteString(query[i : i+end])
+			i += end
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			mark()
+			end := quoteEnd(query, i, c, syntax.BackslashEscapes)
+			line += strings.Count(query[i:end], "\n")
+			buf.WriteString(query[i:end])
+			i = end
+			continue
+		case c == '$' && syntax.DollarQuotes:
+			if tag, ok := dollarTag(query, i); ok {
+				mark()
+				end := strings.Index(query[i+len(tag):], tag)
+				if end == -1 {
+					end = len(query)
+				} else {
+					end += i + 2*len(tag)
+				}
+				line += strings.Count(query[i:end], "\n")
+				buf.WriteString(query[i:end])
+				i = end
+				continue
+			}
+			mark()
+		case syntax.Triggers && isIdentChar(c) && (i == 0 || !isIdentChar(query[i-1])):
+			mark()
+			end := i + 1
+			for end < len(query) && isIdentChar(query[end]) {
+				end++
+			}
+			word := strings.ToUpper(query[i:end])
+			if len(words) < 3 {
+				words = append(words, word)
+				trigger = trigger || isCreateTrigger(words)
+			}
+			if trigger {
+				switch word {
+				case "BEGIN", "CASE":
+					depth++
+				case "END":
+					if depth > 0 {
+						depth--
+					}
+				}
+			}
+			buf.WriteString(query[i:end])
+			i = end
+			continue
+		case c != ' ' && c != '\t' && c != '\r':
+			mark()
+		}
+
+		buf.WriteByte(c)
+		i++
+	}
+
+	flush()
+
+	return stmts
+}
+
+// isCreateTrigger determines if the leading words of a
+// statement are CREATE [TEMP|TEMPORARY] TRIGGER.
+func isCreateTrigger(words []string) bool {
+	if len(words) < 2 || words[0] != "CREATE" {
+		return false
+	}
+	if words[1] == "TRIGGER" {
+		return true
+	}
+	return len(words) == 3 && (words[1] == "TEMP" || words[1] == "TEMPORARY") && words[2] == "TRIGGER"
+}
+
+// quoteEnd returns the index after the closing quote of
+// the quoted string starting at i. Doubled quotes are
+// treated as escaped quotes.
+func quoteEnd(query string, i int, quote byte, backslash bool) int {
+	for j := i + 1; j < len(query); j++ {
+		switch query[j] {
+		case '\\':
+			if backslash && quote != '`' {
+				j++
+			}
+		case quote:
+			if j+1 < len(query) && query[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(query)
+}
+
+// dollarTag returns the dollar quote tag such as $$ or
+// $body$ starting at i, if there is one.
+func dollarTag(query string, i int) (string, bool) {
+	if i > 0 && isIdentChar(query[i-1]) {
+		return "", false
+	}
+	for j := i + 1; j < len(query); j++ {
+		c := query[j]
+		if c == '$' {
+			return query[i : j+1], true
+		}
+		if !isIdentChar(c) || (j == i+1 && c >= '0' && c <= '9') {
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// isIdentChar determines if the character can be used
+// within an identifier.
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// atLineStart determines if only whitespace precedes the
+// index on the current line.
+func atLineStart(query string, i int) bool {
+	for j := i - 1; j >= 0; j-- {
+		switch query[j] {
+		case '\n':
+			return true
+		case ' ', '\t', '\r':
+			continue
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// hasPrefixFold is a case-insensitive strings.HasPrefix.
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
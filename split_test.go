@@ -0,0 +1,178 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tt := map[string]struct {
+		input  string
+		syntax Syntax
+		want   []statement
+	}{
+		"Empty": {
+			"",
+			defaultSyntax,
+			nil,
+		},
+		"Single": {
+			"SELECT 1",
+			defaultSyntax,
+			[]statement{{"SELECT 1", 1}},
+		},
+		"Multiple": {
+			"SELECT 1;\nSELECT 2;\n\nSELECT 3;",
+			defaultSyntax,
+			[]statement{{"SELECT 1", 1}, {"SELECT 2", 2}, {"SELECT 3", 4}},
+		},
+		"Quotes": {
+			`INSERT INTO t VALUES ('a;b', "c;d", ` + "`e;f`" + `, 'it''s;');SELECT 2`,
+			defaultSyntax,
+			[]statement{{`INSERT INTO t VALUES ('a;b', "c;d", ` + "`e;f`" + `, 'it''s;')`, 1}, {"SELECT 2", 1}},
+		},
+		"Backslash Escapes": {
+			`SELECT 'it\'s;';SELECT 2`,
+			defaultSyntax,
+			[]statement{{`SELECT 'it\'s;'`, 1}, {"SELECT 2", 1}},
+		},
+		"No Backslash Escapes": {
+			`SELECT 'C:\';SELECT 2`,
+			Syntax{},
+			[]statement{{`SELECT 'C:\'`, 1}, {"SELECT 2", 1}},
+		},
+		"Line Comments": {
+			"-- comment;\nSELECT 1; -- trailing;\n-- only a comment;",
+			defaultSyntax,
+			[]statement{{"-- comment;\nSELECT 1", 2}},
+		},
+		"Block Comments": {
+			"/* multi\nline; */\nSELECT 1;\n/* end; */",
+			defaultSyntax,
+			[]statement{{"/* multi\nline; */\nSELECT 1", 3}},
+		},
+		"Hash Comments": {
+			"# comment;\nSELECT 1;",
+			Syntax{HashComments: true},
+			[]statement{{"# comment;\nSELECT 1", 2}},
+		},
+		"Dollar Quotes": {
+			"CREATE FUNCTION f() RETURNS int AS $$\nBEGIN\n  RETURN 1;\nEND;\n$$ LANGUAGE plpgsql;\nSELECT $1;",
+			defaultSyntax,
+			[]statement{{"CREATE FUNCTION f() RETURNS int AS $$\nBEGIN\n  RETURN 1;\nEND;\n$$ LANGUAGE plpgsql", 1}, {"SELECT $1", 6}},
+		},
+		"Dollar Tag": {
+			"SELECT $body$ a;$$b $body$;SELECT 2",
+			defaultSyntax,
+			[]statement{{"SELECT $body$ a;$$b $body$", 1}, {"SELECT 2", 1}},
+		},
+		"Dollar Quotes Disabled": {
+			"SELECT $$a;b$$",
+			Syntax{},
+			[]statement{{"SELECT $$a", 1}, {"b$$", 1}},
+		},
+		"Delimiter": {
+			"DELIMITER //\nCREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END//\nDELIMITER ;\nSELECT 3;",
+			defaultSyntax,
+			[]statement{{"CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END", 2}, {"SELECT 3", 4}},
+		},
+		"Trigger": {
+			"CREATE TRIGGER t AFTER INSERT ON a\nBEGIN\n  UPDATE b SET n = CASE WHEN n > 0 THEN n + 1 ELSE 1 END;\n  DELETE FROM c;\nEND;\nSELECT 1;",
+			SQLite.Syntax(),
+			[]statement{
+				{"CREATE TRIGGER t AFTER INSERT ON a\nBEGIN\n  UPDATE b SET n = CASE WHEN n > 0 THEN n + 1 ELSE 1 END;\n  DELETE FROM c;\nEND", 1},
+				{"SELECT 1", 6},
+			},
+		},
+		"Temporary Trigger": {
+			"create temp trigger if not exists t before delete on a when old.id > 0 begin select 'end;'; end;\nBEGIN;\nSELECT 1;\nEND;",
+			SQLite.Syntax(),
+			[]statement{
+				{"create temp trigger if not exists t before delete on a when old.id > 0 begin select 'end;'; end", 1},
+				{"BEGIN", 2},
+				{"SELECT 1", 3},
+				{"END", 4},
+			},
+		},
+		"Trigger Disabled": {
+			"CREATE TRIGGER t AFTER INSERT ON a BEGIN DELETE FROM c; END;",
+			Syntax{},
+			[]statement{{"CREATE TRIGGER t AFTER INSERT ON a BEGIN DELETE FROM c", 1}, {"END", 1}},
+		},
+		"SQLite Delimiter": {
+			"DELIMITER //\nSELECT 1;",
+			SQLite.Syntax(),
+			[]statement{{"DELIMITER //\nSELECT 1", 1}},
+		},
+		"Delimiter Disabled": {
+			"DELIMITER //\nSELECT 1//",
+			Syntax{},
+			[]statement{{"DELIMITER //\nSELECT 1//", 1}},
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			got := splitStatements(test.input, test.syntax)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestExecStatements(t *testing.T) {
+	tt := map[string]struct {
+		input string
+		mock  func(m sqlmock.Sqlmock)
+		want  interface{}
+	}{
+		"Success": {
+			"SELECT 1;\nSELECT 2;",
+			func(m sqlmock.Sqlmock) {
+				m.ExpectExec("SELECT 1").WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectExec("SELECT 2").WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			nil,
+		},
+		"Error": {
+			"SELECT 1;\n\nSELECT 2;",
+			func(m sqlmock.Sqlmock) {
+				m.ExpectExec("SELECT 1").WillReturnResult(sqlmock.NewResult(0, 0))
+				m.ExpectExec("SELECT 2").WillReturnError(fmt.Errorf("syntax error"))
+			},
+			&StatementError{Version: "v0.0.1", Index: 2, Line: 3, Err: fmt.Errorf("syntax error")},
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			mock.ExpectBegin()
+			test.mock(mock)
+
+			tx, err := db.Begin()
+			assert.NoError(t, err)
+
+			err = execStatements(context.Background(), tx, defaultSyntax, "v0.0.1", test.input)
+			if err != nil {
+				var stmtErr *StatementError
+				assert.True(t, errors.As(err, &stmtErr))
+				assert.Equal(t, test.want, stmtErr)
+				assert.Equal(t, "migration v0.0.1: statement 2 on line 3: syntax error", err.Error())
+				return
+			}
+			assert.Nil(t, test.want)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/go-version"
+)
+
+// State describes the migration state of the database
+// as recorded in the history table.
+type State struct {
+	// The highest version that has been successfully
+	// applied, or the currently running version if
+	// nothing has been recorded.
+	Version string `json:"version"`
+	// Dirty is true when a migration failed and could not
+	// be rolled back. Updates are refused until
+	// ForceVersion is called.
+	Dirty bool `json:"dirty"`
+	// The version of the migration that left the database
+	// in a dirty state.
+	DirtyVersion string `json:"dirty_version,omitempty"`
+}
+
+var (
+	// ErrDirty is returned when the database is in a dirty
+	// state due to a failed rollback. The database
+	// should be repaired manually before calling
+	// ForceVersion.
+	ErrDirty = errors.New("database is in a dirty state")
+	// ErrNoDB is returned by ForceVersion when no database
+	// has been set in the options.
+	ErrNoDB = errors.New("no database set")
+)
+
+// Status returns the migration state of the database.
+// If there is no database, the currently running
+// version is returned.
+func (u *Updater) Status() (*State, error) {
+	if !u.opts.hasDB {
+		return &State{Version: u.opts.Version}, nil
+	}
+
+	h, err := u.history(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	state := &State{Version: u.opts.Version}
+	if current := h.current(); current != nil {
+		state.Version = current.Original()
+	}
+
+	if dirty := h.dirty(); dirty != nil {
+		state.Dirty = true
+		state.DirtyVersion = dirty.Version
+	}
+
+	return state, nil
+}
+
+// ForceVersion clears the dirty state and sets the
+// version recorded in the history table, without
+// running any migrations. Records for versions
+// newer than the one passed are removed. It
+// should only be called once the database
+// has been repaired manually.
+func (u *Updater) ForceVersion(v string) error {
+	ver, err := version.NewVersion(v)
+	if err != nil {
+		return err
+	}
+
+	if !u.opts.hasDB {
+		return ErrNoDB
+	}
+
+	ctx := context.Background()
+	_, err = u.withLock(ctx, func() (Status, error) {
+		return DatabaseError, u.forceVersion(ctx, ver)
+	})
+
+	return err
+}
+
+// forceVersion removes the dirty records and those newer
+// than the version passed, and records the version as
+// applied within a transaction.
+func (u *Updater) forceVersion(ctx context.Context, ver *version.Version) error {
+	h, err := u.history(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := u.opts.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, bind(u.dialect(), "DELETE FROM "+historyTable+" WHERE dirty = ?"), true)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	var (
+		applied   = false
+		forgotten = make(map[string]bool)
+	)
+
+	for _, r := range h {
+		rv, err := version.NewVersion(r.Version)
+		if err != nil || r.Dirty {
+			continue
+		}
+		if rv.Equal(ver) && r.Success {
+			applied = true
+		}
+		if !rv.GreaterThan(ver) || forgotten[r.Version] {
+			continue
+		}
+		forgotten[r.Version] = true
+		err = u.forget(ctx, tx, &Migration{Version: r.Version})
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	if !applied {
+		record := historyRecord{Version: ver.Original(), Success: true}
+		if m, err := u.registry().Get(ver.Original()); err == nil {
+			record.Stage = u.registry().Stage(m)
+		}
+		err = u.record(ctx, tx, record)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// checkDirty returns ErrDirty if the history contains
+// a dirty record.
+func (h history) checkDirty() error {
+	if dirty := h.dirty(); dirty != nil {
+		return fmt.Errorf("%w: %s", ErrDirty, dirty.Version)
+	}
+	return nil
+}
+
+// checkDirty returns ErrDirty if the database is in a
+// dirty state, nil is returned if there is no
+// database.
+func (u *Updater) checkDirty(ctx context.Context) error {
+	if !u.opts.hasDB {
+		return nil
+	}
+	h, err := u.history(ctx)
+	if err != nil {
+		return err
+	}
+	return h.checkDirty()
+}
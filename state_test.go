@@ -0,0 +1,191 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"fmt"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// expectDirtyHistory adds the expectations for retrieving
+// the history table with a successful record for the
+// applied version and a dirty record for the
+// failed version.
+func expectDirtyHistory(m sqlmock.Sqlmock, applied, failed string) {
+	m.ExpectExec("CREATE TABLE IF NOT EXISTS " + historyTable).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	m.ExpectQuery("SELECT version, success, dirty, checksum FROM " + historyTable).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "success", "dirty", "checksum"}).
+			AddRow(applied, true, false, "").
+			AddRow(failed, false, true, ""))
+}
+
+func TestUpdater_Status(t *testing.T) {
+	tt := map[string]struct {
+		db   bool
+		mock func(m sqlmock.Sqlmock)
+		want interface{}
+	}{
+		"No DB": {
+			false,
+			nil,
+			&State{Version: "v0.0.1"},
+		},
+		"Empty": {
+			true,
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m)
+			},
+			&State{Version: "v0.0.1"},
+		},
+		"Applied": {
+			true,
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.2", "v0.0.3")
+			},
+			&State{Version: "v0.0.3"},
+		},
+		"Dirty": {
+			true,
+			func(m sqlmock.Sqlmock) {
+				expectDirtyHistory(m, "v0.0.2", "v0.0.3")
+			},
+			&State{Version: "v0.0.2", Dirty: true, DirtyVersion: "v0.0.3"},
+		},
+		"Error": {
+			true,
+			func(m sqlmock.Sqlmock) {
+				m.ExpectExec("CREATE TABLE IF NOT EXISTS " + historyTable).
+					WillReturnError(fmt.Errorf("error"))
+			},
+			"error",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			if test.mock != nil {
+				test.mock(mock)
+			}
+
+			u := Updater{opts: Options{DB: db, hasDB: test.db, Version: "v0.0.1"}}
+			got, err := u.Status()
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestUpdater_ForceVersion(t *testing.T) {
+	tt := map[string]struct {
+		input string
+		db    bool
+		mock  func(m sqlmock.Sqlmock)
+		want  interface{}
+	}{
+		"Dirty": {
+			"v0.0.2",
+			true,
+			func(m sqlmock.Sqlmock) {
+				expectDirtyHistory(m, "v0.0.2", "v0.0.3")
+				m.ExpectBegin()
+				m.ExpectExec("DELETE FROM " + historyTable + " WHERE dirty").
+					WithArgs(true).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				m.ExpectCommit()
+			},
+			nil,
+		},
+		"Newer Versions": {
+			"v0.0.1",
+			true,
+			func(m sqlmock.Sqlmock) {
+				expectHistory(m, "v0.0.2", "v0.0.3")
+				m.ExpectBegin()
+				m.ExpectExec("DELETE FROM " + historyTable + " WHERE dirty").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				expectForget(m, "v0.0.2")
+				expectForget(m, "v0.0.3")
+				expectRecord(m, "v0.0.1", true)
+				m.ExpectCommit()
+			},
+			nil,
+		},
+		"Bad Version": {
+			"wrong",
+			true,
+			nil,
+			"Malformed version",
+		},
+		"No DB": {
+			"v0.0.1",
+			false,
+			nil,
+			ErrNoDB.Error(),
+		},
+		"Delete Error": {
+			"v0.0.2",
+			true,
+			func(m sqlmock.Sqlmock) {
+				expectDirtyHistory(m, "v0.0.2", "v0.0.3")
+				m.ExpectBegin()
+				m.ExpectExec("DELETE FROM " + historyTable + " WHERE dirty").
+					WillReturnError(fmt.Errorf("delete error"))
+				m.ExpectRollback()
+			},
+			"delete error",
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			if test.mock != nil {
+				test.mock(mock)
+			}
+
+			u := Updater{opts: Options{DB: db, hasDB: test.db}}
+			err = u.ForceVersion(test.input)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.Nil(t, test.want)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUpdater_RunDirty(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	expectDirtyHistory(mock, "v0.0.1", "v0.0.2")
+
+	u := Updater{
+		opts:    Options{DB: db, hasDB: true},
+		version: version.Must(version.NewVersion("v0.0.1")),
+	}
+
+	code, err := u.runMigrations(context.Background(), u.version, version.Must(version.NewVersion("v0.0.3")))
+	assert.Equal(t, Status(Dirty), code)
+	assert.ErrorIs(t, err, ErrDirty)
+	assert.Contains(t, err.Error(), "v0.0.2")
+}
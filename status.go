@@ -30,6 +30,28 @@ const (
 	// Updated is the success status code returned by Update
 	// when everything passed.
 	Updated = 6
+	// Downgraded is the success status code returned when
+	// migrations have been reversed to an older version.
+	Downgraded = 7
+	// Pending is returned by Update when the executable has
+	// been updated and migrations have been deferred to
+	// the new executable via ResumePending.
+	Pending = 8
+	// Locked is returned when the migration lock could not
+	// be acquired as another instance is migrating.
+	Locked = 9
+	// Dirty is returned when a previous migration failed
+	// and could not be rolled back. Updates are refused
+	// until the state is cleared with ForceVersion.
+	Dirty = 10
+	// Drifted is returned when RefuseDrift is set and the
+	// SQL of an applied migration no longer matches the
+	// checksum recorded in the history.
+	Drifted = 11
+	// ApprovalRequired is returned when a release or a
+	// pending migration crosses a stage that must be
+	// approved according to the Policy.
+	ApprovalRequired = 12
 )
 
 // getExecStatus transforms the pkg updater status into
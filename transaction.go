@@ -0,0 +1,200 @@
+// Copyright 2020 The Verbis Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package updater
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/hashicorp/go-version"
+)
+
+// TxMode defines how a migration is run in relation to
+// database transactions.
+type TxMode int
+
+const (
+	// TxShared runs the migration within a transaction that
+	// is shared with the neighbouring migrations that
+	// also use TxShared. This is the default. If the
+	// dialect cannot roll back DDL statements, such
+	// as MySQL, TxOwn is used instead.
+	TxShared TxMode = iota
+	// TxOwn runs the migration within its own transaction
+	// which is committed as soon as the migration has
+	// been processed.
+	TxOwn
+	// TxNone runs the migration outside of a transaction,
+	// for statements such as CREATE INDEX CONCURRENTLY.
+	// If the migration fails, it cannot be rolled back
+	// and the database is marked as dirty.
+	TxNone
+)
+
+// String returns the name of the transaction mode.
+func (t TxMode) String() string {
+	switch t {
+	case TxOwn:
+		return "own"
+	case TxNone:
+		return "none"
+	}
+	return "shared"
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// batch tracks the transaction shared between migrations
+// as well as the migrations that have been processed
+// within it, and those that have been committed.
+type batch struct {
+	// The context transactions are started with.
+	ctx context.Context
+	// The versions being migrated between, passed to the
+	// functions of each migration.
+	from, to *version.Version
+	// The database, nil if there is none set.
+	db *sql.DB
+	// Whether DDL statements can be rolled back by the
+	// dialect of the database.
+	ddl bool
+	// The open shared transaction.
+	tx *sql.Tx
+	// Migrations processed within the shared transaction,
+	// or all processed migrations when there is no
+	// database.
+	uncommitted MigrationRegistry
+	// Migrations that have been committed.
+	committed MigrationRegistry
+	// Partial is set when a migration failed outside of
+	// a transaction, or within a transaction that DDL
+	// statements could have committed, and could
+	// have been partially applied.
+	partial bool
+}
+
+// newBatch returns a new batch for the Updater migrating
+// between the versions passed.
+func (u *Updater) newBatch(ctx context.Context, from, to *version.Version) *batch {
+	b := &batch{ctx: ctx, from: from, to: to, ddl: u.dialect().TransactionalDDL()}
+	if u.opts.hasDB {
+		b.db = u.opts.DB
+	}
+	return b
+}
+
+// txMode returns the transaction mode the migration is
+// run with. As DDL statements implicitly commit the
+// transaction on dialects without transactional
+// DDL, migrations are not shared between
+// transactions on those dialects.
+func txMode(m *Migration, ddl bool) TxMode {
+	if m.Transaction == TxShared && !ddl {
+		return TxOwn
+	}
+	return m.Transaction
+}
+
+// run calls the function with an execer that depends on
+// the transaction mode of the migration. The shared
+// transaction is committed before a migration that
+// uses TxOwn or TxNone, so migrations are always
+// committed in order. Without transactional DDL,
+// a failed migration is treated as partially
+// applied as its DDL cannot be rolled back.
+func (b *batch) run(m *Migration, fn func(ex execer) (Status, error)) (Status, error) {
+	if b.db == nil {
+		code, err := fn(nil)
+		if err != nil {
+			return code, err
+		}
+		b.uncommitted = append(b.uncommitted, m)
+		return code, nil
+	}
+
+	switch txMode(m, b.ddl) {
+	case TxOwn:
+		err := b.commit()
+		if err != nil {
+			return DatabaseError, err
+		}
+		tx, err := b.db.BeginTx(b.ctx, nil)
+		if err != nil {
+			return DatabaseError, err
+		}
+		code, err := fn(tx)
+		if err != nil {
+			_ = tx.Rollback()
+			b.partial = !b.ddl
+			return code, err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return DatabaseError, err
+		}
+		b.committed = append(b.committed, m)
+		return code, nil
+	case TxNone:
+		err := b.commit()
+		if err != nil {
+			return DatabaseError, err
+		}
+		code, err := fn(b.db)
+		if err != nil {
+			b.partial = true
+			return code, err
+		}
+		b.committed = append(b.committed, m)
+		return code, nil
+	default:
+		if b.tx == nil {
+			tx, err := b.db.BeginTx(b.ctx, nil)
+			if err != nil {
+				return DatabaseError, err
+			}
+			b.tx = tx
+		}
+		code, err := fn(b.tx)
+		if err != nil {
+			return code, err
+		}
+		b.uncommitted = append(b.uncommitted, m)
+		return code, nil
+	}
+}
+
+// commit commits the shared transaction if there is one
+// open, and marks its migrations as committed.
+func (b *batch) commit() error {
+	if b.tx == nil {
+		return nil
+	}
+	err := b.tx.Commit()
+	b.tx = nil
+	if err != nil {
+		return err
+	}
+	b.committed = append(b.committed, b.uncommitted...)
+	b.uncommitted = nil
+	return nil
+}
+
+// rollback rolls back the shared transaction if there is
+// one open. The transaction is already rolled back
+// if the context has been cancelled.
+func (b *batch) rollback() error {
+	if b.tx == nil {
+		return nil
+	}
+	err := b.tx.Rollback()
+	b.tx = nil
+	if errors.Is(err, sql.ErrTxDone) {
+		return nil
+	}
+	return err
+}
@@ -5,9 +5,12 @@
 package updater
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/hashicorp/go-version"
-	"github.com/mouuff/go-rocket-update/pkg/provider"
 	"github.com/mouuff/go-rocket-update/pkg/updater"
+	"sync"
 )
 
 // Patcher describes the set of methods used for determining
@@ -15,18 +18,34 @@ import (
 // latest version and running migrations.
 type Patcher interface {
 	Update(archive string) (Status, error)
+	UpdateContext(ctx context.Context, archive string) (Status, error)
+	Downgrade(target, archive string) (Status, error)
+	DowngradeContext(ctx context.Context, target, archive string) (Status, error)
 	HasUpdate() (bool, error)
+	HasUpdateContext(ctx context.Context) (bool, error)
 	LatestVersion() (string, error)
+	LatestVersionContext(ctx context.Context) (string, error)
+	Plan(archive string) (*Plan, error)
+	PlanContext(ctx context.Context, archive string) (*Plan, error)
 }
 
 // Updater represents the library for updating golang
 // executables and running migrations.
 type Updater struct {
-	opts    Options
-	pkg     *updater.Updater
-	version *version.Version
+	opts     Options
+	pkg      *updater.Updater
+	version  *version.Version
+	mu       sync.Mutex
+	approved map[string]bool
 }
 
+var (
+	// ErrDowngradeVersion is returned by Downgrade when the
+	// target version is not older than the currently
+	// running version.
+	ErrDowngradeVersion = errors.New("invalid downgrade version")
+)
+
 // New returns a new Updater with the options passed. If
 // validation failed on the options an error will be
 // returned.
@@ -44,9 +63,6 @@ func New(opts Options) (*Updater, error) {
 	u := &Updater{
 		opts: opts,
 		pkg: &updater.Updater{
-			Provider: &provider.Github{
-				RepositoryURL: opts.GithubURL,
-			},
 			Version: opts.Version,
 		},
 		version: ver,
@@ -57,31 +73,126 @@ func New(opts Options) (*Updater, error) {
 
 // HasUpdate determines if there is an update for the
 // program. Returns a error if there are no releases
-// or tags for the repo.
+// or tags for the repo. False is returned with
+// ErrApprovalRequired if the update must be
+// approved according to the Policy.
 func (u *Updater) HasUpdate() (bool, error) {
-	return u.pkg.CanUpdate()
+	return u.HasUpdateContext(context.Background())
+}
+
+// HasUpdateContext is HasUpdate with a context that
+// bounds the request for the latest version.
+func (u *Updater) HasUpdateContext(ctx context.Context) (bool, error) {
+	latest, err := u.LatestVersionContext(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	target, err := version.NewVersion(latest)
+	if err != nil {
+		return false, err
+	}
+
+	if target.Equal(u.version) {
+		return false, nil
+	}
+
+	ms, err := u.pendingMigrations(ctx, target)
+	if err != nil {
+		return false, err
+	}
+
+	err = u.checkPolicy(target, ms)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
 // LatestVersion retrieves the most up to date version of
 // the program. Returns a error if there are no releases
-//// or tags for the repo.
+// or tags for the repo.
 func (u *Updater) LatestVersion() (string, error) {
-	return u.pkg.GetLatestVersion()
+	return u.LatestVersionContext(context.Background())
+}
+
+// LatestVersionContext is LatestVersion with a context
+// that bounds the request to the Source.
+func (u *Updater) LatestVersionContext(ctx context.Context) (string, error) {
+	return u.source().LatestVersion(ctx)
 }
 
 // Update takes in the archive name of the zip file or
 // folder to download and proceeds to update the
 // executable and migrates any database queries
-// or callbacks. If there was an error in any
+// or callbacks up to and including the version
+// that was installed. If there was an error in any
 // of the processes, the package will
 // rollback to the previous state.
+//
+// If DeferMigrations is set in the options, the
+// migrations are not run, and a marker is written
+// so the newly installed executable can apply its
+// own migrations by calling ResumePending.
+//
+// If DelegateMigrations is set in the options, the
+// newly installed executable is run with the
+// MigrateFlag to apply its own migrations and
+// the update is rolled back if they failed.
+//
+// ApprovalRequired is returned without downloading
+// anything if the release, or a pending migration,
+// must be approved according to the Policy.
 func (u *Updater) Update(archive string) (Status, error) {
-	u.pkg.Provider = &provider.Github{
-		RepositoryURL: u.opts.GithubURL,
-		ArchiveName:   archive,
+	return u.UpdateContext(context.Background(), archive)
+}
+
+// UpdateContext is Update with a context that bounds the
+// requests to the Source, the download of the archive,
+// verification of the executable and migrations.
+// If the context is cancelled whilst migrating,
+// the update is rolled back.
+func (u *Updater) UpdateContext(ctx context.Context, archive string) (Status, error) {
+	err := u.checkDirty(ctx)
+	if errors.Is(err, ErrDirty) {
+		return Dirty, err
+	} else if err != nil {
+		return DatabaseError, err
+	}
+
+	if u.opts.RefuseDrift {
+		err = u.checkDrift(ctx)
+		if errors.Is(err, ErrDrift) {
+			return Drifted, err
+		} else if err != nil {
+			return DatabaseError, err
+		}
+	}
+
+	latest, err := u.LatestVersionContext(ctx)
+	if err != nil {
+		return ExecutableError, err
 	}
 
-	update, err := u.pkg.Update()
+	target, err := version.NewVersion(latest)
+	if err != nil {
+		return ExecutableError, err
+	}
+
+	ms, err := u.pendingMigrations(ctx, target)
+	if err != nil {
+		return DatabaseError, err
+	}
+
+	err = u.checkPolicy(target, ms)
+	if err != nil {
+		return ApprovalRequired, err
+	}
+
+	pkg := u.release(ctx, latest, archive)
+
+	update, err := pkg.Update()
 	status := getExecStatus(update)
 
 	if err != nil {
@@ -89,20 +200,110 @@ func (u *Updater) Update(archive string) (Status, error) {
 	}
 
 	if u.opts.Verify {
-		err = u.verifyInstallation()
+		err = u.verifyInstallation(ctx, latest)
 		if err != nil {
 			return ExecutableError, err
 		}
 	}
 
-	status, err = u.runMigrations()
-	if err != nil {
-		rollBackErr := u.pkg.Rollback()
-		if rollBackErr != nil {
+	if u.opts.DeferMigrations && status == Updated {
+		err = u.writePending(latest)
+		if err != nil {
+			_ = pkg.Rollback()
+			return ExecutableError, err
+		}
+		return Pending, nil
+	}
+
+	if u.opts.DelegateMigrations && status == Updated {
+		status, err = u.delegate(ctx)
+		if err != nil {
+			_ = pkg.Rollback()
 			return status, err
 		}
+		return status, nil
+	}
+
+	status, err = u.runMigrations(ctx, u.version, target)
+	if err != nil {
+		_ = pkg.Rollback()
 		return status, err
 	}
 
 	return status, nil
 }
+
+// Downgrade takes in the target version and the archive
+// name of the zip file or folder of that release and
+// proceeds to replace the executable with the older
+// release. Migrations newer than the target are then
+// reversed in descending order by running their
+// SQLDown and CallBackDown. If there was an error
+// reversing migrations, the executable will be
+// rolled back to the currently running one.
+func (u *Updater) Downgrade(target, archive string) (Status, error) {
+	return u.DowngradeContext(context.Background(), target, archive)
+}
+
+// DowngradeContext is Downgrade with a context that bounds
+// the download of the archive, verification of the
+// executable and reversing migrations.
+func (u *Updater) DowngradeContext(ctx context.Context, target, archive string) (Status, error) {
+	ver, err := version.NewVersion(target)
+	if err != nil {
+		return Unknown, err
+	}
+
+	if !ver.LessThan(u.version) {
+		return Unknown, fmt.Errorf("%w: %s is not older than %s", ErrDowngradeVersion, target, u.opts.Version)
+	}
+
+	err = u.checkDirty(ctx)
+	if errors.Is(err, ErrDirty) {
+		return Dirty, err
+	} else if err != nil {
+		return DatabaseError, err
+	}
+
+	pkg := u.release(ctx, target, archive)
+
+	update, err := pkg.Update()
+	if err != nil {
+		return getExecStatus(update), err
+	}
+
+	if u.opts.Verify {
+		err = u.verifyInstallation(ctx, target)
+		if err != nil {
+			return ExecutableError, err
+		}
+	}
+
+	status, err := u.MigrateDownContext(ctx, target)
+	if err != nil {
+		_ = pkg.Rollback()
+		return status, err
+	}
+
+	return Downgraded, nil
+}
+
+// release returns a package updater that installs the
+// archive of the release from the Source, using the
+// executable of the Updater.
+func (u *Updater) release(ctx context.Context, tag, archive string) *updater.Updater {
+	pkg := &updater.Updater{
+		Provider: &sourceRelease{
+			source:  u.source(),
+			archive: archive,
+			version: tag,
+			ctx:     ctx,
+		},
+		Version: u.opts.Version,
+	}
+	if u.pkg != nil {
+		pkg.ExecutableName = u.pkg.ExecutableName
+		pkg.OverrideExecutable = u.pkg.OverrideExecutable
+	}
+	return pkg
+}
@@ -5,10 +5,18 @@
 package updater
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"github.com/mouuff/go-rocket-update/pkg/provider"
+	"github.com/hashicorp/go-version"
 	"github.com/mouuff/go-rocket-update/pkg/updater"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -49,68 +57,63 @@ var (
 	TestVersion = "v0.0.1"            //nolint
 )
 
-type mockAccessProvider struct{}
-
-func (a *mockAccessProvider) Walk(walkFn provider.WalkFunc) error {
-	return nil
+// mockSource is a Source returning the TestVersion and
+// the archive passed.
+type mockSource struct {
+	archive []byte
 }
 
-func (a *mockAccessProvider) Open() error {
-	return nil
+func (m *mockSource) Releases(ctx context.Context) ([]string, error) {
+	return []string{TestVersion}, ctx.Err()
 }
 
-func (a *mockAccessProvider) Close() error {
-	return nil
+func (m *mockSource) LatestVersion(ctx context.Context) (string, error) {
+	return TestVersion, ctx.Err()
 }
 
-func (a *mockAccessProvider) GetLatestVersion() (string, error) {
-	return TestVersion, nil
+func (m *mockSource) Open(ctx context.Context, version, archive string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(m.archive)), ctx.Err()
 }
 
-func (a *mockAccessProvider) Retrieve(srcPath, destPath string) error {
-	return nil
+func (m *mockSource) URL(version, archive string) (string, error) {
+	return "https://example.com/" + version + "/" + archive, nil
 }
 
-type mockAccessProviderErr struct{}
-
-func (a *mockAccessProviderErr) Walk(walkFn provider.WalkFunc) error {
-	return nil
-}
+type mockSourceErr struct{}
 
-func (a *mockAccessProviderErr) Open() error {
-	return nil
+func (m *mockSourceErr) Releases(ctx context.Context) ([]string, error) {
+	return nil, fmt.Errorf("error")
 }
 
-func (a *mockAccessProviderErr) Close() error {
-	return nil
-}
-
-func (a *mockAccessProviderErr) GetLatestVersion() (string, error) {
+func (m *mockSourceErr) LatestVersion(ctx context.Context) (string, error) {
 	return "", fmt.Errorf("error")
 }
 
-func (a *mockAccessProviderErr) Retrieve(srcPath, destPath string) error {
-	return nil
+func (m *mockSourceErr) Open(ctx context.Context, version, archive string) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("error")
 }
 
 func TestUpdater_HasUpdate(t *testing.T) {
 	tt := map[string]struct {
-		input provider.Provider
+		input Source
 		want  interface{}
 	}{
 		"Success": {
-			&mockAccessProvider{},
+			&mockSource{},
 			true,
 		},
 		"Error": {
-			&mockAccessProviderErr{},
+			&mockSourceErr{},
 			TestErr.Error(),
 		},
 	}
 
 	for name, test := range tt {
 		t.Run(name, func(t *testing.T) {
-			u := Updater{pkg: &updater.Updater{Provider: test.input}}
+			u := Updater{
+				opts:    Options{Source: test.input},
+				version: version.Must(version.NewVersion("v0.0.0")),
+			}
 			got, err := u.HasUpdate()
 			if err != nil {
 				assert.Contains(t, err.Error(), test.want)
@@ -123,22 +126,22 @@ func TestUpdater_HasUpdate(t *testing.T) {
 
 func TestUpdater_LatestVersion(t *testing.T) {
 	tt := map[string]struct {
-		input provider.Provider
+		input Source
 		want  interface{}
 	}{
 		"Success": {
-			&mockAccessProvider{},
+			&mockSource{},
 			TestVersion,
 		},
 		"Error": {
-			&mockAccessProviderErr{},
+			&mockSourceErr{},
 			TestErr.Error(),
 		},
 	}
 
 	for name, test := range tt {
 		t.Run(name, func(t *testing.T) {
-			u := Updater{pkg: &updater.Updater{Provider: test.input}}
+			u := Updater{opts: Options{Source: test.input}}
 			got, err := u.LatestVersion()
 			if err != nil {
 				assert.Contains(t, err.Error(), test.want)
@@ -149,6 +152,148 @@ func TestUpdater_LatestVersion(t *testing.T) {
 	}
 }
 
+func TestUpdater_LatestVersionContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"name": "v0.0.3"}, {"name": "v0.0.2"}]`))
+	}))
+	defer ts.Close()
+
+	original := githubAPIURL
+	githubAPIURL = ts.URL
+	defer func() {
+		githubAPIURL = original
+	}()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tt := map[string]struct {
+		ctx   context.Context
+		input Source
+		want  interface{}
+	}{
+		"Github": {
+			context.Background(),
+			&GithubSource{RepositoryURL: "https://github.com/ainsleyclark/verbis"},
+			"v0.0.3",
+		},
+		"Github Cancelled": {
+			cancelled,
+			&GithubSource{RepositoryURL: "https://github.com/ainsleyclark/verbis"},
+			context.Canceled.Error(),
+		},
+		"Provider": {
+			context.Background(),
+			&mockSource{},
+			TestVersion,
+		},
+		"Provider Cancelled": {
+			cancelled,
+			&mockSource{},
+			context.Canceled.Error(),
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			u := Updater{opts: Options{Source: test.input}}
+			got, err := u.LatestVersionContext(test.ctx)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				return
+			}
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
 func TestUpdater_Update(t *testing.T) {
 	// TODO
 }
+
+func TestUpdater_Downgrade(t *testing.T) {
+	tt := map[string]struct {
+		target string
+		status int
+		input  MigrationRegistry
+		want   interface{}
+		code   Status
+	}{
+		"Success": {
+			"v0.0.1",
+			http.StatusOK,
+			MigrationRegistry{
+				&Migration{Version: "v0.0.2", Stage: Patch, CallBackUp: func() error {
+					return nil
+				}, CallBackDown: func() error {
+					return nil
+				}},
+			},
+			"new",
+			Downgraded,
+		},
+		"Bad Version": {
+			"wrong",
+			http.StatusOK,
+			nil,
+			"Malformed version",
+			Unknown,
+		},
+		"Not Older": {
+			"v0.0.3",
+			http.StatusOK,
+			nil,
+			ErrDowngradeVersion.Error(),
+			Unknown,
+		},
+		"Download Error": {
+			"v0.0.1",
+			http.StatusNotFound,
+			nil,
+			"404",
+			ExecutableError,
+		},
+		"Migration Error": {
+			"v0.0.1",
+			http.StatusOK,
+			MigrationRegistry{
+				&Migration{Version: "v0.0.2", Stage: Patch, CallBackUp: func() error {
+					return nil
+				}, CallBackDown: func() error {
+					return fmt.Errorf("callback error")
+				}},
+			},
+			"callback error",
+			CallBackError,
+		},
+	}
+
+	for name, test := range tt {
+		t.Run(name, func(t *testing.T) {
+			teardown := testRelease(t, testArchive(t, map[string]string{"verbis": "new"}), test.status)
+			defer teardown()
+
+			exec := filepath.Join(t.TempDir(), "verbis")
+			assert.NoError(t, ioutil.WriteFile(exec, []byte("old"), os.ModePerm))
+
+			registry := testRegistry(test.input)
+
+			u := Updater{
+				opts:    Options{GithubURL: "https://github.com/ainsleyclark/verbis", Version: "v0.0.2", Registry: registry},
+				pkg:     &updater.Updater{OverrideExecutable: exec},
+				version: version.Must(version.NewVersion("v0.0.2")),
+			}
+
+			code, err := u.Downgrade(test.target, "verbis.zip")
+			assert.Equal(t, test.code, code)
+			got, readErr := ioutil.ReadFile(exec)
+			assert.NoError(t, readErr)
+			if err != nil {
+				assert.Contains(t, err.Error(), test.want)
+				assert.Equal(t, "old", string(got))
+				return
+			}
+			assert.Equal(t, test.want, string(got))
+		})
+	}
+}
@@ -1,8 +1,8 @@
 package updater
 
 import (
+	"context"
 	"errors"
-	"os"
 	"os/exec"
 	"strings"
 )
@@ -16,34 +16,33 @@ var (
 
 // verifyInstallation verifies if the executable is installed
 // correctly. The downloaded executable is run with the
-// flag -version.
+// flag -version and the output is compared to the
+// version passed.
 // Returns ErrVersionMisMatch if the versions could n ot be
 // matched.
-func (u *Updater) verifyInstallation() error {
-	latestVersion, err := u.LatestVersion()
+func (u *Updater) verifyInstallation(ctx context.Context, version string) error {
+	output, err := u.execute(ctx, "-version")
 	if err != nil {
 		return err
 	}
+	strOutput := string(output)
 
-	executable, err := os.Executable()
-	if err != nil {
-		return err
+	if !strings.Contains(strOutput, version) {
+		return ErrVersionMisMatch
 	}
 
-	cmd := exec.Cmd{
-		Path: executable,
-		Args: []string{executable, "-version"},
-	}
+	return nil
+}
 
-	output, err := cmd.Output()
+// execute runs the installed executable with the
+// arguments passed and returns the output. The
+// process is killed if the context is done
+// before it exits.
+func (u *Updater) execute(ctx context.Context, args ...string) ([]byte, error) {
+	executable, err := u.pkg.GetExecutable()
 	if err != nil {
-		return err
-	}
-	strOutput := string(output)
-
-	if !strings.Contains(strOutput, latestVersion) {
-		return ErrVersionMisMatch
+		return nil, err
 	}
 
-	return nil
+	return exec.CommandContext(ctx, executable, args...).Output()
 }